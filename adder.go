@@ -0,0 +1,150 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// busWires resolves each wire of a bus, following aliases
+func (c *Circuit) busWires(prefix string) ([]string, error) {
+	width, ok := c.Buses[prefix]
+	if !ok {
+		return nil, fmt.Errorf("bus %s not found", prefix)
+	}
+	wires := make([]string, width)
+	for i := range wires {
+		wire, err := c.resolveWire(fmt.Sprintf("%s%d", prefix, i))
+		if err != nil {
+			return nil, err
+		}
+		wires[i] = wire
+	}
+	return wires, nil
+}
+
+// AddAdder adds the bus a to the bus b in place with the Cuccaro ripple-carry
+// adder (https://arxiv.org/abs/quant-ph/0410184). The wire carry must be
+// zero and is restored, the carry out is xored into the wire z unless z is
+// empty.
+func (c *Circuit) AddAdder(a, b, carry, z string) {
+	as, err := c.busWires(a)
+	if err != nil {
+		panic(err)
+	}
+	bs, err := c.busWires(b)
+	if err != nil {
+		panic(err)
+	}
+	if len(as) != len(bs) {
+		panic(fmt.Errorf("bus %s has width %d but %s has width %d", a, len(as), b, len(bs)))
+	}
+	carry, err = c.resolveWire(carry)
+	if err != nil {
+		panic(err)
+	}
+	if z != "" {
+		z, err = c.resolveWire(z)
+		if err != nil {
+			panic(err)
+		}
+	}
+	c.addAdder(as, bs, carry, z)
+}
+
+// addAdder is AddAdder for lists of wires
+func (c *Circuit) addAdder(as, bs []string, carry, z string) {
+	if len(as) != len(bs) {
+		panic(fmt.Errorf("adding %d wires to %d wires", len(as), len(bs)))
+	}
+	if len(as) == 0 {
+		return
+	}
+	maj := func(x, y, z string) {
+		c.AddGateCNot(z, y)
+		c.AddGateCNot(z, x)
+		c.AddGateCCNot(x, y, z)
+	}
+	uma := func(x, y, z string) {
+		c.AddGateCCNot(x, y, z)
+		c.AddGateCNot(z, x)
+		c.AddGateCNot(x, y)
+	}
+	previous := carry
+	for i := range as {
+		maj(previous, bs[i], as[i])
+		previous = as[i]
+	}
+	if z != "" {
+		c.AddGateCNot(as[len(as)-1], z)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		previous = carry
+		if i > 0 {
+			previous = as[i-1]
+		}
+		uma(previous, bs[i], as[i])
+	}
+}
+
+// AddSubtractor subtracts the bus a from the bus b in place with the inverse
+// of the Cuccaro adder, the borrow is xored into the wire z unless z is empty
+func (c *Circuit) AddSubtractor(a, b, carry, z string) {
+	start := len(c.Gates)
+	c.AddAdder(a, b, carry, z)
+	c.reverseGates(start)
+}
+
+// addSubtractor is AddSubtractor for lists of wires
+func (c *Circuit) addSubtractor(as, bs []string, carry, z string) {
+	start := len(c.Gates)
+	c.addAdder(as, bs, carry, z)
+	c.reverseGates(start)
+}
+
+// reverseGates reverses the order of the gates after start, which inverts
+// them when they are all self inverse
+func (c *Circuit) reverseGates(start int) {
+	gates := c.Gates[start:]
+	for i, j := 0, len(gates)-1; i < j; i, j = i+1, j-1 {
+		gates[i], gates[j] = gates[j], gates[i]
+	}
+}
+
+func cuccaro(size int, subtract bool) Circuit {
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("A", size, false)
+	circuit.AddBus("B", size, false)
+	circuit.AddBus("C", 1, false)
+	circuit.AddBus("Z", 1, false)
+	circuit.AddBus("S", 0, true)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("A", "I")
+	circuit.AddAlias("B", "I")
+	circuit.AddAlias("A", "G")
+
+	if subtract {
+		circuit.AddSubtractor("A", "B", "C0", "Z0")
+	} else {
+		circuit.AddAdder("A", "B", "C0", "Z0")
+	}
+
+	circuit.AddAlias("B", "S")
+	circuit.AddAlias("Z0", "S")
+
+	return circuit
+}
+
+// CuccaroAdder computes S = A + B with S having one more bit than A and B
+func CuccaroAdder(size int) Circuit {
+	return cuccaro(size, false)
+}
+
+// CuccaroSubtractor computes S = B - A in two's complement with S having one
+// more bit than A and B
+func CuccaroSubtractor(size int) Circuit {
+	return cuccaro(size, true)
+}
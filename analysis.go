@@ -0,0 +1,137 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type BusReport struct {
+	Name  string
+	Width int
+	Alias bool
+}
+
+type Report struct {
+	Counts      map[GateType]int
+	Gates       int
+	Depth       int
+	QuantumCost int
+	Wires       int
+	Ancilla     int
+	Garbage     int
+	Buses       []BusReport
+}
+
+// QuantumCost is the number of elementary quantum gates needed to implement
+// the gate, following the costs used by RevLib
+func (g *Gate) QuantumCost() int {
+	switch g.Type {
+	case GateTypeNot, GateTypeCNot:
+		return 1
+	case GateTypeCCNot, GateTypeFredkin:
+		return 5
+	case GateTypePeres:
+		return 4
+	case GateTypeMCNot:
+		controls := len(g.Taps) - 1
+		if controls < 2 {
+			return 1
+		}
+		return 1<<uint(controls+1) - 3
+	}
+	return 0
+}
+
+func (c *Circuit) Depth() int {
+	levels, depth := make([]int, len(c.Wires)), 0
+	for _, gate := range c.Gates {
+		level := 0
+		for _, tap := range gate.Taps {
+			if levels[tap] > level {
+				level = levels[tap]
+			}
+		}
+		level++
+		for _, tap := range gate.Taps {
+			levels[tap] = level
+		}
+		if level > depth {
+			depth = level
+		}
+	}
+	return depth
+}
+
+func (c *Circuit) Analyze() Report {
+	report := Report{
+		Counts: make(map[GateType]int),
+		Gates:  len(c.Gates),
+		Depth:  c.Depth(),
+		Wires:  len(c.Wires),
+	}
+	for i := range c.Gates {
+		report.Counts[c.Gates[i].Type]++
+		report.QuantumCost += c.Gates[i].QuantumCost()
+	}
+
+	inputs, garbage := make(map[string]bool), make(map[string]bool)
+	for alias, name := range c.Aliases {
+		prefix, _, ok := splitName(alias)
+		if !ok {
+			continue
+		}
+		switch prefix {
+		case "I":
+			inputs[name] = true
+		case "G":
+			garbage[name] = true
+		}
+	}
+	for name := range c.Wires {
+		if !inputs[name] {
+			report.Ancilla++
+		}
+		if garbage[name] {
+			report.Garbage++
+		}
+	}
+
+	for name, width := range c.Buses {
+		_, wire := c.Wires[fmt.Sprintf("%s0", name)]
+		report.Buses = append(report.Buses, BusReport{
+			Name:  name,
+			Width: int(width),
+			Alias: width > 0 && !wire,
+		})
+	}
+	sort.Slice(report.Buses, func(i, j int) bool {
+		return report.Buses[i].Name < report.Buses[j].Name
+	})
+	return report
+}
+
+func (r *Report) Print() {
+	types := make([]GateType, 0, len(r.Counts))
+	for t := range r.Counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	fmt.Printf("gates=%d depth=%d cost=%d\n", r.Gates, r.Depth, r.QuantumCost)
+	for _, t := range types {
+		fmt.Printf("  %s=%d\n", t, r.Counts[t])
+	}
+	fmt.Printf("wires=%d ancilla=%d garbage=%d\n", r.Wires, r.Ancilla, r.Garbage)
+	for _, bus := range r.Buses {
+		kind := "wires"
+		if bus.Alias {
+			kind = "alias"
+		}
+		fmt.Printf("  %s[%d] %s\n", bus.Name, bus.Width, kind)
+	}
+}
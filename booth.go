@@ -0,0 +1,124 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// signExtend interprets the low width bits of value as two's complement
+func signExtend(value uint64, width uint32) int64 {
+	if width > 0 && width < 64 && value&(1<<(width-1)) != 0 {
+		value |= ^uint64(0) << width
+	}
+	return int64(value)
+}
+
+// Booth computes the signed P = Y * X for an xBits wide X and a yBits wide Y
+// in two's complement. X is recoded into the radix-4 Booth digits
+// -2, -1, 0, 1 and 2, so there are half as many partial products as in
+// Multiplier. The carries out of P are garbage.
+func Booth(xBits, yBits int, reduction Reduction, full FullAdder, half HalfAdder) Circuit {
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("Y", yBits, false)
+	circuit.AddBus("X", xBits, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("P", xBits+yBits, true)
+	circuit.AddBus("Z", 0, false)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("Y", "I")
+	circuit.AddAlias("X", "I")
+	circuit.AddAlias("Y", "G")
+	circuit.AddAlias("X", "G")
+
+	y, err := circuit.busWires("Y")
+	if err != nil {
+		panic(err)
+	}
+	x, err := circuit.busWires("X")
+	if err != nil {
+		panic(err)
+	}
+	if len(x) == 0 || len(y) == 0 {
+		panic(fmt.Errorf("signed operands need at least one bit"))
+	}
+	// bit sign extends x and y
+	bit := func(wires []string, i int) string {
+		if i < 0 {
+			return ""
+		} else if i >= len(wires) {
+			return wires[len(wires)-1]
+		}
+		return wires[i]
+	}
+
+	width := xBits + yBits
+	sums := make([][]string, width)
+	for i := 0; 2*i < xBits; i++ {
+		high, middle, low := bit(x, 2*i+1), bit(x, 2*i), bit(x, 2*i-1)
+
+		// the digit is -2*high + middle + low
+		start := len(circuit.Gates)
+		one := circuit.AddWire("A", false)
+		circuit.AddGateCNot(middle, one)
+		if low != "" {
+			circuit.AddGateCNot(low, one)
+		}
+		two := ""
+		if high != middle {
+			two = circuit.AddWire("A", false)
+			if low != "" {
+				circuit.AddGateMCNot(high, "-"+middle, "-"+low, two)
+				circuit.AddGateMCNot("-"+high, middle, low, two)
+			} else {
+				circuit.AddGateMCNot(high, "-"+middle, two)
+			}
+		}
+		encode := append([]Gate{}, circuit.Gates[start:]...)
+
+		// the partial product is (one*y | two*2y) xored with high, plus high
+		sign := ""
+		for j := 0; j <= yBits; j++ {
+			product := circuit.AddWire("A", false)
+			circuit.AddGateCCNot(one, bit(y, j), product)
+			if two != "" && j > 0 {
+				circuit.AddGateCCNot(two, bit(y, j-1), product)
+			}
+			circuit.AddGateCNot(high, product)
+			sums[2*i+j] = append(sums[2*i+j], product)
+			sign = product
+		}
+		for j := 2*i + yBits + 1; j < width; j++ {
+			extension := circuit.AddWire("A", false)
+			circuit.AddGateCNot(sign, extension)
+			sums[j] = append(sums[j], extension)
+		}
+		correction := circuit.AddWire("A", false)
+		circuit.AddGateCNot(high, correction)
+		sums[2*i] = append(sums[2*i], correction)
+
+		// uncompute the digit
+		for j := len(encode) - 1; j >= 0; j-- {
+			circuit.Gates = append(circuit.Gates, encode[j].remap(nil))
+		}
+	}
+
+	outputs := reduction(&circuit, sums, full, half)
+	for i, output := range outputs {
+		if i >= width {
+			if output != "" {
+				circuit.AddAlias(output, "G")
+			}
+			continue
+		}
+		if output == "" {
+			output = circuit.AddWire("Z", false)
+		}
+		circuit.AddAlias(output, fmt.Sprintf("P%d", i))
+	}
+
+	return circuit
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// Builder constructs a circuit like the Circuit methods do, but returns an
+// error instead of panicking or silently using the wrong wire
+type Builder struct {
+	*Circuit
+}
+
+func NewBuilder() *Builder {
+	circuit := NewCircuit()
+	return &Builder{
+		Circuit: &circuit,
+	}
+}
+
+func (b *Builder) AddBus(prefix string, count int, alias bool, nominal ...bool) error {
+	return b.addBus(prefix, count, alias, nominal...)
+}
+
+func (b *Builder) AddWire(name string, nominal bool) (string, error) {
+	return b.addWire(name, nominal)
+}
+
+func (b *Builder) AddAlias(name, alias string) ([]string, error) {
+	return b.addAlias(name, alias)
+}
+
+func (b *Builder) add(t GateType, taps ...string) error {
+	gate, err := b.newGate(t, taps...)
+	if err != nil {
+		return err
+	}
+	b.Gates = append(b.Gates, gate)
+	return nil
+}
+
+func (b *Builder) AddGateNot(a string) error {
+	return b.add(GateTypeNot, a)
+}
+
+func (b *Builder) AddGateCNot(a, c string) error {
+	return b.add(GateTypeCNot, a, c)
+}
+
+func (b *Builder) AddGateCCNot(a, c, d string) error {
+	return b.add(GateTypeCCNot, a, c, d)
+}
+
+func (b *Builder) AddGateFredkin(a, c, d string) error {
+	return b.add(GateTypeFredkin, a, c, d)
+}
+
+func (b *Builder) AddGatePeres(a, c, d string) error {
+	return b.add(GateTypePeres, a, c, d)
+}
+
+func (b *Builder) AddGateMCNot(taps ...string) error {
+	return b.add(GateTypeMCNot, taps...)
+}
+
+func (b *Builder) Build() (Circuit, error) {
+	return *b.Circuit, b.Validate()
+}
+
+func (c *Circuit) Validate() error {
+	indexes := make([]string, len(c.Wires))
+	for name, wire := range c.Wires {
+		if wire.Name != name {
+			return fmt.Errorf("wire %s is named %s", name, wire.Name)
+		}
+		if int(wire.Index) >= len(c.Wires) {
+			return fmt.Errorf("wire %s has invalid index %d", name, wire.Index)
+		}
+		if other := indexes[wire.Index]; other != "" {
+			return fmt.Errorf("wires %s and %s have the same index %d", other, name, wire.Index)
+		}
+		indexes[wire.Index] = name
+	}
+
+	for alias, name := range c.Aliases {
+		if _, ok := c.Wires[alias]; ok {
+			return fmt.Errorf("alias %s is also a wire", alias)
+		}
+		wire, err := c.resolveWire(name)
+		if err != nil {
+			return fmt.Errorf("alias %s: %v", alias, err)
+		}
+		if wire != name {
+			return fmt.Errorf("alias %s refers to alias %s", alias, name)
+		}
+	}
+
+	for prefix, width := range c.Buses {
+		for i := 0; i < int(width); i++ {
+			name := fmt.Sprintf("%s%d", prefix, i)
+			_, wire := c.Wires[name]
+			_, alias := c.Aliases[name]
+			if !wire && !alias {
+				return fmt.Errorf("bus %s is missing %s", prefix, name)
+			}
+		}
+	}
+
+	for i, gate := range c.Gates {
+		count := 3
+		switch gate.Type {
+		case GateTypeNot:
+			count = 1
+		case GateTypeCNot:
+			count = 2
+		case GateTypeCCNot, GateTypeFredkin, GateTypePeres:
+		case GateTypeMCNot:
+			count = len(gate.Taps)
+			if count == 0 {
+				return fmt.Errorf("gate %d has no target", i)
+			}
+			if gate.Negative != nil && len(gate.Negative) != count-1 {
+				return fmt.Errorf("gate %d has %d negative flags for %d controls", i, len(gate.Negative), count-1)
+			}
+		default:
+			return fmt.Errorf("gate %d has unknown type %s", i, gate.Type)
+		}
+		if len(gate.Taps) != count {
+			return fmt.Errorf("gate %d is a %s with %d taps", i, gate.Type, len(gate.Taps))
+		}
+		for j, tap := range gate.Taps {
+			if int(tap) >= len(c.Wires) {
+				return fmt.Errorf("gate %d has invalid tap %d", i, tap)
+			}
+			for _, previous := range gate.Taps[:j] {
+				if previous == tap {
+					return fmt.Errorf("gate %d uses wire %s twice", i, indexes[tap])
+				}
+			}
+		}
+	}
+	return nil
+}
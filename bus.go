@@ -0,0 +1,29 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// Bus is a bus resolved to the memory index of each of its wires
+type Bus []uint32
+
+// NewBus resolves the bus prefix of circuit
+func NewBus(c *Circuit, prefix string) Bus {
+	wires, err := c.busWires(prefix)
+	if err != nil {
+		panic(err)
+	}
+	bus := make(Bus, len(wires))
+	for i, wire := range wires {
+		bus[i] = c.Wires[wire].Index
+	}
+	return bus
+}
+
+func (b Bus) fits() {
+	if len(b) > 64 {
+		panic(fmt.Errorf("bus of width %d is larger than uint64", len(b)))
+	}
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/alixaxel/pagerank"
 )
@@ -17,8 +18,29 @@ const (
 	GateTypeNot GateType = iota
 	GateTypeCNot
 	GateTypeCCNot
+	GateTypeFredkin
+	GateTypePeres
+	GateTypeMCNot
 )
 
+func (g GateType) String() string {
+	switch g {
+	case GateTypeNot:
+		return "Not"
+	case GateTypeCNot:
+		return "CNot"
+	case GateTypeCCNot:
+		return "CCNot"
+	case GateTypeFredkin:
+		return "Fredkin"
+	case GateTypePeres:
+		return "Peres"
+	case GateTypeMCNot:
+		return "MCNot"
+	}
+	return fmt.Sprintf("GateType(%d)", int(g))
+}
+
 type Wire struct {
 	Name    string
 	Nominal bool
@@ -27,8 +49,48 @@ type Wire struct {
 }
 
 type Gate struct {
-	Type GateType
-	Taps [3]uint32
+	Type     GateType
+	Taps     []uint32
+	Negative []bool
+}
+
+// Normalize replaces a multi-controlled Toffoli gate without negative
+// controls by the equivalent Not, CNot or CCNot gate
+func (g Gate) Normalize() Gate {
+	if g.Type != GateTypeMCNot {
+		return g
+	}
+	for _, negative := range g.Negative {
+		if negative {
+			return g
+		}
+	}
+	g.Negative = nil
+	switch len(g.Taps) {
+	case 1:
+		g.Type = GateTypeNot
+	case 2:
+		g.Type = GateTypeCNot
+	case 3:
+		g.Type = GateTypeCCNot
+	}
+	return g
+}
+
+func (g *Gate) Targets() []uint32 {
+	switch g.Type {
+	case GateTypeFredkin, GateTypePeres:
+		return g.Taps[1:]
+	}
+	return g.Taps[len(g.Taps)-1:]
+}
+
+func (g *Gate) Controls() []uint32 {
+	switch g.Type {
+	case GateTypeFredkin, GateTypePeres:
+		return g.Taps[:1]
+	}
+	return g.Taps[:len(g.Taps)-1]
 }
 
 type Circuit struct {
@@ -46,19 +108,30 @@ func NewCircuit() Circuit {
 	}
 }
 
-func (c *Circuit) AddBus(prefix string, count int, alias bool, nominal ...bool) {
+func (c *Circuit) addBus(prefix string, count int, alias bool, nominal ...bool) error {
 	_, ok := c.Buses[prefix]
 	if ok {
-		panic(fmt.Errorf("bus %s already exists", prefix))
+		return fmt.Errorf("bus %s already exists", prefix)
 	}
-	c.Buses[prefix] = uint32(count)
-	if alias {
-		return
+	if count < 0 {
+		return fmt.Errorf("bus %s has negative width %d", prefix, count)
 	}
 	nom := false
 	if len(nominal) > 0 {
 		nom = nominal[0]
 	}
+	if !alias {
+		for i := 0; i < count; i++ {
+			name := fmt.Sprintf("%s%d", prefix, i)
+			if _, ok := c.Wires[name]; ok {
+				return fmt.Errorf("wire %s already exists", name)
+			}
+		}
+	}
+	c.Buses[prefix] = uint32(count)
+	if alias {
+		return nil
+	}
 	for i := 0; i < count; i++ {
 		name := fmt.Sprintf("%s%d", prefix, i)
 		c.Wires[name] = Wire{
@@ -67,46 +140,142 @@ func (c *Circuit) AddBus(prefix string, count int, alias bool, nominal ...bool)
 			Index:   uint32(len(c.Wires)),
 		}
 	}
+	return nil
 }
 
-func (c *Circuit) AddWire(name string, nominal bool) string {
-	if i, ok := c.Buses[name]; ok {
-		c.Buses[name] = i + 1
-		name = fmt.Sprintf("%s%d", name, i)
+func (c *Circuit) addWire(name string, nominal bool) (string, error) {
+	bus, i := name, uint32(0)
+	if width, ok := c.Buses[name]; ok {
+		name, i = fmt.Sprintf("%s%d", name, width), width
 	}
-	_, ok := c.Wires[name]
-	if ok {
-		panic(fmt.Errorf("wire %s already exists", name))
+	if _, ok := c.Wires[name]; ok {
+		return name, fmt.Errorf("wire %s already exists", name)
+	}
+	if _, ok := c.Aliases[name]; ok {
+		return name, fmt.Errorf("wire %s is already an alias", name)
+	}
+	if name != bus {
+		c.Buses[bus] = i + 1
 	}
 	c.Wires[name] = Wire{
 		Name:    name,
 		Nominal: nominal,
 		Index:   uint32(len(c.Wires)),
 	}
-	return name
+	return name, nil
 }
 
-func (c *Circuit) AddAlias(name, alias string) []string {
-	f := func(name, alias string) string {
-		if i, ok := c.Buses[alias]; ok {
-			c.Buses[alias] = i + 1
-			alias = fmt.Sprintf("%s%d", alias, i)
+// resolveWire follows aliases until a wire is found
+func (c *Circuit) resolveWire(name string) (string, error) {
+	seen := make(map[string]bool)
+	for {
+		if _, ok := c.Wires[name]; ok {
+			return name, nil
+		}
+		next, ok := c.Aliases[name]
+		if !ok {
+			return name, fmt.Errorf("unknown wire %s", name)
+		}
+		if seen[name] {
+			return name, fmt.Errorf("alias cycle at %s", name)
+		}
+		seen[name], name = true, next
+	}
+}
+
+func (c *Circuit) addAlias(name, alias string) ([]string, error) {
+	f := func(name, alias string) (string, error) {
+		name, err := c.resolveWire(name)
+		if err != nil {
+			return alias, err
+		}
+		prefix := alias
+		i, bus := c.Buses[prefix]
+		if bus {
+			alias = fmt.Sprintf("%s%d", prefix, i)
+		}
+		if _, ok := c.Aliases[alias]; ok {
+			return alias, fmt.Errorf("alias %s already exists", alias)
 		}
-		_, ok := c.Aliases[alias]
-		if ok {
-			panic(fmt.Errorf("alias %s already exists", alias))
+		if _, ok := c.Wires[alias]; ok {
+			return alias, fmt.Errorf("alias %s is already a wire", alias)
+		}
+		if bus {
+			c.Buses[prefix] = i + 1
 		}
 		c.Aliases[alias] = name
-		return alias
+		return alias, nil
 	}
 	if i, ok := c.Buses[name]; ok {
 		aliases := make([]string, i)
 		for j := 0; j < int(i); j++ {
-			aliases[j] = f(fmt.Sprintf("%s%d", name, j), alias)
+			a, err := f(fmt.Sprintf("%s%d", name, j), alias)
+			if err != nil {
+				return aliases[:j], err
+			}
+			aliases[j] = a
 		}
-		return aliases
+		return aliases, nil
 	}
-	return []string{f(name, alias)}
+	a, err := f(name, alias)
+	if err != nil {
+		return nil, err
+	}
+	return []string{a}, nil
+}
+
+// newGate looks up the taps of a gate, a tap that isn't a wire or that is
+// used twice is an error
+func (c *Circuit) newGate(t GateType, taps ...string) (Gate, error) {
+	gate := Gate{
+		Type: t,
+		Taps: make([]uint32, len(taps)),
+	}
+	if t == GateTypeMCNot {
+		if len(taps) == 0 {
+			return gate, fmt.Errorf("gate needs a target")
+		}
+		gate.Negative = make([]bool, len(taps)-1)
+	}
+	for i, tap := range taps {
+		if i < len(gate.Negative) && strings.HasPrefix(tap, "-") {
+			tap, gate.Negative[i] = tap[1:], true
+		}
+		wire, ok := c.Wires[tap]
+		if !ok {
+			return gate, fmt.Errorf("unknown wire %s", tap)
+		}
+		for _, previous := range gate.Taps[:i] {
+			if previous == wire.Index {
+				return gate, fmt.Errorf("wire %s is used twice by %s gate", tap, t)
+			}
+		}
+		gate.Taps[i] = wire.Index
+	}
+	return gate.Normalize(), nil
+}
+
+func (c *Circuit) AddBus(prefix string, count int, alias bool, nominal ...bool) {
+	err := c.addBus(prefix, count, alias, nominal...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (c *Circuit) AddWire(name string, nominal bool) string {
+	name, err := c.addWire(name, nominal)
+	if err != nil {
+		panic(err)
+	}
+	return name
+}
+
+func (c *Circuit) AddAlias(name, alias string) []string {
+	aliases, err := c.addAlias(name, alias)
+	if err != nil {
+		panic(err)
+	}
+	return aliases
 }
 
 func (c *Circuit) Resolve(name string) string {
@@ -117,28 +286,38 @@ func (c *Circuit) Resolve(name string) string {
 	return name
 }
 
-func (c *Circuit) AddGateNot(a string) {
-	gate := Gate{
-		Type: GateTypeNot,
-		Taps: [3]uint32{c.Wires[a].Index},
+func (c *Circuit) addGate(t GateType, taps ...string) {
+	gate, err := c.newGate(t, taps...)
+	if err != nil {
+		panic(err)
 	}
 	c.Gates = append(c.Gates, gate)
 }
 
+func (c *Circuit) AddGateNot(a string) {
+	c.addGate(GateTypeNot, a)
+}
+
 func (c *Circuit) AddGateCNot(a, b string) {
-	gate := Gate{
-		Type: GateTypeCNot,
-		Taps: [3]uint32{c.Wires[a].Index, c.Wires[b].Index},
-	}
-	c.Gates = append(c.Gates, gate)
+	c.addGate(GateTypeCNot, a, b)
 }
 
 func (cc *Circuit) AddGateCCNot(a, b, c string) {
-	gate := Gate{
-		Type: GateTypeCCNot,
-		Taps: [3]uint32{cc.Wires[a].Index, cc.Wires[b].Index, cc.Wires[c].Index},
-	}
-	cc.Gates = append(cc.Gates, gate)
+	cc.addGate(GateTypeCCNot, a, b, c)
+}
+
+func (cc *Circuit) AddGateFredkin(a, b, c string) {
+	cc.addGate(GateTypeFredkin, a, b, c)
+}
+
+func (cc *Circuit) AddGatePeres(a, b, c string) {
+	cc.addGate(GateTypePeres, a, b, c)
+}
+
+// AddGateMCNot adds a Toffoli gate with any number of controls; the last tap
+// is the target and controls prefixed with "-" are active on zero
+func (c *Circuit) AddGateMCNot(taps ...string) {
+	c.addGate(GateTypeMCNot, taps...)
 }
 
 func (c *Circuit) ComputeRanks() {
@@ -155,6 +334,20 @@ func (c *Circuit) ComputeRanks() {
 			graph.Link(gate.Taps[1], gate.Taps[2], 0.5)
 			//graph.Link(gate.Taps[2], gate.Taps[0], 0.5)
 			//graph.Link(gate.Taps[2], gate.Taps[1], 0.5)
+		case GateTypeFredkin:
+			graph.Link(gate.Taps[0], gate.Taps[1], 0.5)
+			graph.Link(gate.Taps[0], gate.Taps[2], 0.5)
+			graph.Link(gate.Taps[1], gate.Taps[2], 0.5)
+			graph.Link(gate.Taps[2], gate.Taps[1], 0.5)
+		case GateTypePeres:
+			graph.Link(gate.Taps[0], gate.Taps[1], 1.0)
+			graph.Link(gate.Taps[0], gate.Taps[2], 0.5)
+			graph.Link(gate.Taps[1], gate.Taps[2], 0.5)
+		case GateTypeMCNot:
+			target := len(gate.Taps) - 1
+			for _, control := range gate.Taps[:target] {
+				graph.Link(control, gate.Taps[target], 1.0/float64(target))
+			}
 		}
 	}
 	graph.Rank(0.9, 0.000001, func(node uint32, rank float64) {
@@ -198,44 +391,46 @@ func (c *Circuit) PrintConnections(name string) {
 			if c == index {
 				fmt.Println(gate)
 			}
+		case GateTypeFredkin, GateTypePeres:
+			b, c := gate.Taps[1], gate.Taps[2]
+			if b == index || c == index {
+				fmt.Println(gate)
+			}
+		case GateTypeMCNot:
+			if gate.Taps[len(gate.Taps)-1] == index {
+				fmt.Println(gate)
+			}
 		}
 	}
 }
 
 func (c *Circuit) NewDeviceBool() DeviceBool {
-	memory := make([]bool, len(c.Wires))
+	return NewDevice[bool](c, BoolLogic{})
+}
+
+func (c *Circuit) NewDeviceParallel() DeviceParallel {
+	memory := make([]uint64, len(c.Wires))
 	for _, value := range c.Wires {
-		memory[value.Index] = value.Nominal
+		memory[value.Index] = lanes(value.Nominal)
 	}
-	return DeviceBool{
+	return DeviceParallel{
 		Circuit: c,
 		Memory:  memory,
 	}
 }
 
 func (c *Circuit) NewDeviceFloat32() DeviceFloat32 {
-	memory := make([]float32, len(c.Wires))
-	for _, value := range c.Wires {
-		if value.Nominal {
-			memory[value.Index] = 1.0
-		}
-	}
-	return DeviceFloat32{
-		Circuit: c,
-		Memory:  memory,
-	}
+	return NewDevice[float32](c, FloatLogic[float32]{})
+}
+
+func (c *Circuit) NewDeviceFloat64() DeviceFloat64 {
+	return NewDevice[float64](c, FloatLogic[float64]{})
 }
 
 func (c *Circuit) NewDeviceDual(mapping Mapping) DeviceDual {
-	memory := make([]Dual, len(c.Wires))
-	for _, value := range c.Wires {
-		if value.Nominal {
-			memory[value.Index] = Dual{Val: 1.0}
-		}
-	}
-	return DeviceDual{
-		Circuit: c,
-		Memory:  memory,
-		Mapping: mapping,
-	}
+	return NewDevice[Dual](c, DualLogic[float32]{MappingOf: mapping})
+}
+
+func (c *Circuit) NewDeviceDual64(mapping Mapping64) DeviceDual64 {
+	return NewDevice[Dual64](c, DualLogic[float64]{MappingOf: mapping})
 }
@@ -0,0 +1,104 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// comparands resolves the wires of two buses of the same width and the
+// output wire z
+func (c *Circuit) comparands(a, b, z string) (as, bs []string, wire string) {
+	as, err := c.busWires(a)
+	if err != nil {
+		panic(err)
+	}
+	bs, err = c.busWires(b)
+	if err != nil {
+		panic(err)
+	}
+	if len(as) != len(bs) {
+		panic(fmt.Errorf("bus %s has width %d but %s has width %d", a, len(as), b, len(bs)))
+	}
+	wire, err = c.resolveWire(z)
+	if err != nil {
+		panic(err)
+	}
+	return as, bs, wire
+}
+
+// addCarry xors the carry out of as + bs into z with the majority chain of
+// the Cuccaro adder, all of the other wires are restored
+func (c *Circuit) addCarry(as, bs []string, carry, z string) {
+	start := len(c.Gates)
+	previous := carry
+	for i := range as {
+		c.AddGateCNot(as[i], bs[i])
+		c.AddGateCNot(as[i], previous)
+		c.AddGateCCNot(previous, bs[i], as[i])
+		previous = as[i]
+	}
+	end := len(c.Gates)
+	c.AddGateCNot(previous, z)
+	for i := end - 1; i >= start; i-- {
+		c.Gates = append(c.Gates, c.Gates[i].remap(nil))
+	}
+}
+
+// AddLessThan xors a < b into the wire z, the buses a and b are unsigned
+// and restored. The wire carry must be zero and is restored.
+func (c *Circuit) AddLessThan(a, b, carry, z string) {
+	as, bs, z := c.comparands(a, b, z)
+	if len(as) == 0 {
+		return
+	}
+	carry, err := c.resolveWire(carry)
+	if err != nil {
+		panic(err)
+	}
+	// a < b when ^a + b carries
+	for _, wire := range as {
+		c.AddGateNot(wire)
+	}
+	c.addCarry(as, bs, carry, z)
+	for _, wire := range as {
+		c.AddGateNot(wire)
+	}
+}
+
+// AddEqual xors a == b into the wire z, the buses a and b are restored
+func (c *Circuit) AddEqual(a, b, z string) {
+	as, bs, z := c.comparands(a, b, z)
+	taps := make([]string, 0, len(bs)+1)
+	for i := range as {
+		c.AddGateCNot(as[i], bs[i])
+		taps = append(taps, "-"+bs[i])
+	}
+	c.AddGateMCNot(append(taps, z)...)
+	for i := range as {
+		c.AddGateCNot(as[i], bs[i])
+	}
+}
+
+// Comparator computes L = A < B and E = A == B
+func Comparator(size int) Circuit {
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("A", size, false)
+	circuit.AddBus("B", size, false)
+	circuit.AddBus("L", 1, false)
+	circuit.AddBus("E", 1, false)
+	circuit.AddBus("Z", 1, false)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("A", "I")
+	circuit.AddAlias("B", "I")
+	circuit.AddAlias("A", "G")
+	circuit.AddAlias("B", "G")
+
+	circuit.AddLessThan("A", "B", "Z0", "L0")
+	circuit.AddEqual("A", "B", "E0")
+
+	return circuit
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+func (c *Circuit) Copy() Circuit {
+	circuit := NewCircuit()
+	for name, width := range c.Buses {
+		circuit.Buses[name] = width
+	}
+	for name, wire := range c.Wires {
+		circuit.Wires[name] = wire
+	}
+	for alias, name := range c.Aliases {
+		circuit.Aliases[alias] = name
+	}
+	circuit.Gates = make([]Gate, len(c.Gates))
+	for i, gate := range c.Gates {
+		circuit.Gates[i] = gate.remap(nil)
+	}
+	return circuit
+}
+
+// remap copies the gate replacing each tap with its entry in taps
+func (g Gate) remap(taps []uint32) Gate {
+	gate := Gate{
+		Type: g.Type,
+		Taps: make([]uint32, len(g.Taps)),
+	}
+	for i, tap := range g.Taps {
+		if taps != nil {
+			tap = taps[tap]
+		}
+		gate.Taps[i] = tap
+	}
+	if g.Negative != nil {
+		gate.Negative = append([]bool{}, g.Negative...)
+	}
+	return gate
+}
+
+// Inverse returns a circuit with the same wires that computes the inverse
+// function; a Peres gate is inverted into a CNot followed by a CCNot
+func (c *Circuit) Inverse() Circuit {
+	circuit := c.Copy()
+	circuit.Gates = circuit.Gates[:0]
+	for i := len(c.Gates) - 1; i >= 0; i-- {
+		gate := c.Gates[i].remap(nil)
+		if gate.Type == GateTypePeres {
+			a, b, d := gate.Taps[0], gate.Taps[1], gate.Taps[2]
+			circuit.Gates = append(circuit.Gates,
+				Gate{Type: GateTypeCNot, Taps: []uint32{a, b}},
+				Gate{Type: GateTypeCCNot, Taps: []uint32{a, b, d}})
+			continue
+		}
+		circuit.Gates = append(circuit.Gates, gate)
+	}
+	return circuit
+}
+
+// Embed adds the wires, buses, aliases and gates of sub to the circuit with
+// their names prefixed by prefix. The buses of sub that are keys of ports are
+// not copied, instead their wires are connected to the bus of the circuit
+// named by the value.
+func (c *Circuit) Embed(sub *Circuit, prefix string, ports map[string]string) error {
+	names := c.WiresByIndex()
+	taps, mapped, used := make([]uint32, len(sub.Wires)), make([]bool, len(sub.Wires)), make(map[uint32]string)
+	buses := make([]string, 0, len(ports))
+	for bus := range ports {
+		buses = append(buses, bus)
+	}
+	sort.Strings(buses)
+	for _, bus := range buses {
+		target := ports[bus]
+		width, ok := sub.Buses[bus]
+		if !ok {
+			return fmt.Errorf("bus %s not found", bus)
+		}
+		if w, ok := c.Buses[target]; !ok {
+			return fmt.Errorf("bus %s not found", target)
+		} else if w != width {
+			return fmt.Errorf("bus %s has width %d but %s has width %d", bus, width, target, w)
+		}
+		for i := 0; i < int(width); i++ {
+			from, err := sub.resolveWire(fmt.Sprintf("%s%d", bus, i))
+			if err != nil {
+				return err
+			}
+			to, err := c.resolveWire(fmt.Sprintf("%s%d", target, i))
+			if err != nil {
+				return err
+			}
+			a, b := sub.Wires[from].Index, c.Wires[to].Index
+			if mapped[a] && taps[a] != b {
+				return fmt.Errorf("wire %s is connected to both %s and %s", from, names[taps[a]].Name, to)
+			}
+			if other, ok := used[b]; ok && other != from {
+				return fmt.Errorf("wire %s is connected to both %s and %s", to, other, from)
+			}
+			taps[a], mapped[a], used[b] = b, true, from
+		}
+	}
+
+	inPorts := func(name string) bool {
+		bus, _, ok := splitName(name)
+		_, port := ports[bus]
+		return ok && port
+	}
+	exists := func(name string) error {
+		if _, ok := c.Wires[name]; ok {
+			return fmt.Errorf("wire %s already exists", name)
+		}
+		if _, ok := c.Aliases[name]; ok {
+			return fmt.Errorf("alias %s already exists", name)
+		}
+		return nil
+	}
+	wires := sub.WiresByIndex()
+	for _, wire := range wires {
+		if !mapped[wire.Index] || !inPorts(wire.Name) {
+			if err := exists(prefix + wire.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for alias := range sub.Aliases {
+		if !inPorts(alias) {
+			if err := exists(prefix + alias); err != nil {
+				return err
+			}
+		}
+	}
+	for bus := range sub.Buses {
+		if _, port := ports[bus]; !port {
+			if _, ok := c.Buses[prefix+bus]; ok {
+				return fmt.Errorf("bus %s already exists", prefix+bus)
+			}
+		}
+	}
+
+	for _, wire := range wires {
+		name := prefix + wire.Name
+		if mapped[wire.Index] {
+			if !inPorts(wire.Name) {
+				c.Aliases[name] = names[taps[wire.Index]].Name
+			}
+			continue
+		}
+		taps[wire.Index] = uint32(len(c.Wires))
+		c.Wires[name] = Wire{
+			Name:    name,
+			Nominal: wire.Nominal,
+			Index:   taps[wire.Index],
+		}
+		names = append(names, c.Wires[name])
+	}
+	for bus, width := range sub.Buses {
+		if _, port := ports[bus]; !port {
+			c.Buses[prefix+bus] = width
+		}
+	}
+	for alias, name := range sub.Aliases {
+		if !inPorts(alias) {
+			c.Aliases[prefix+alias] = names[taps[sub.Wires[name].Index]].Name
+		}
+	}
+	for _, gate := range sub.Gates {
+		c.Gates = append(c.Gates, gate.remap(taps))
+	}
+	return nil
+}
+
+// Concatenate returns a circuit which executes the circuits one after the
+// other; wires, buses and aliases with the same name are shared
+func Concatenate(circuits ...*Circuit) (Circuit, error) {
+	circuit := NewCircuit()
+	for _, sub := range circuits {
+		for bus, width := range sub.Buses {
+			if w, ok := circuit.Buses[bus]; ok && w != width {
+				return circuit, fmt.Errorf("bus %s has widths %d and %d", bus, w, width)
+			}
+		}
+		for alias, name := range sub.Aliases {
+			if other, ok := circuit.Aliases[alias]; ok && other != name {
+				return circuit, fmt.Errorf("alias %s refers to both %s and %s", alias, other, name)
+			}
+			if _, ok := circuit.Wires[alias]; ok {
+				return circuit, fmt.Errorf("alias %s is also a wire", alias)
+			}
+		}
+		taps := make([]uint32, len(sub.Wires))
+		for _, wire := range sub.WiresByIndex() {
+			if _, ok := circuit.Aliases[wire.Name]; ok {
+				return circuit, fmt.Errorf("wire %s is also an alias", wire.Name)
+			}
+			existing, ok := circuit.Wires[wire.Name]
+			if !ok {
+				existing = Wire{
+					Name:    wire.Name,
+					Nominal: wire.Nominal,
+					Index:   uint32(len(circuit.Wires)),
+				}
+				circuit.Wires[wire.Name] = existing
+			} else if existing.Nominal != wire.Nominal {
+				return circuit, fmt.Errorf("wire %s has different nominal values", wire.Name)
+			}
+			taps[wire.Index] = existing.Index
+		}
+		for bus, width := range sub.Buses {
+			circuit.Buses[bus] = width
+		}
+		for alias, name := range sub.Aliases {
+			circuit.Aliases[alias] = name
+		}
+		for _, gate := range sub.Gates {
+			circuit.Gates = append(circuit.Gates, gate.remap(taps))
+		}
+	}
+	return circuit, nil
+}
+
+// Bennett returns a garbage free version of the circuit with Bennett's
+// compute, copy and uncompute scheme. The outputs P are copied to new O wires
+// and then the circuit is inverted, so every other wire is restored and the
+// garbage G is just the inputs I.
+func Bennett(c *Circuit) (Circuit, error) {
+	circuit := c.Copy()
+	outputs, err := c.busWires("P")
+	if err != nil {
+		return circuit, err
+	}
+	inputs, err := c.busWires("I")
+	if err != nil {
+		return circuit, err
+	}
+	for alias := range circuit.Aliases {
+		if prefix, _, ok := splitName(alias); ok && (prefix == "P" || prefix == "G") {
+			delete(circuit.Aliases, alias)
+		}
+	}
+	circuit.Buses["P"], circuit.Buses["G"] = 0, 0
+
+	err = circuit.addBus("O", len(outputs), false)
+	if err != nil {
+		return circuit, err
+	}
+	for i, output := range outputs {
+		name := fmt.Sprintf("O%d", i)
+		gate, err := circuit.newGate(GateTypeCNot, output, name)
+		if err != nil {
+			return circuit, err
+		}
+		circuit.Gates = append(circuit.Gates, gate)
+		_, err = circuit.addAlias(name, "P")
+		if err != nil {
+			return circuit, err
+		}
+	}
+	for _, input := range inputs {
+		_, err = circuit.addAlias(input, "G")
+		if err != nil {
+			return circuit, err
+		}
+	}
+
+	inverse := c.Inverse()
+	circuit.Gates = append(circuit.Gates, inverse.Gates...)
+	return circuit, nil
+}
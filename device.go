@@ -0,0 +1,444 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// Device simulates a circuit on some representation of a bit
+type Device interface {
+	Reset()
+	SetUint64(prefix string, value uint64)
+	Uint64(prefix string) uint64
+	SetInt64(prefix string, value int64)
+	Int64(prefix string) int64
+	Print(prefix string, count int)
+	Execute(reverse bool)
+}
+
+var (
+	_ Device = (*DeviceBool)(nil)
+	_ Device = (*DeviceFloat32)(nil)
+	_ Device = (*DeviceDual)(nil)
+)
+
+// Logic implements the gates for cells of type T
+type Logic[T any] interface {
+	Cell(bit bool) T
+	Bit(a T) bool
+	Not(a T) T
+	CNot(a, b T) T
+	CCNot(a, b, c T) T
+	Fredkin(a, b, c T) (T, T)
+	Peres(a, b, c T) (T, T)
+	InversePeres(a, b, c T) (T, T)
+	MCNot(a []T, b T) T
+}
+
+// BoolLogic is boolean logic
+type BoolLogic struct {
+}
+
+func (BoolLogic) Cell(bit bool) bool {
+	return bit
+}
+
+func (BoolLogic) Bit(a bool) bool {
+	return a
+}
+
+func (BoolLogic) Not(a bool) bool {
+	return !a
+}
+
+func (BoolLogic) CNot(a, b bool) bool {
+	return a != b
+}
+
+func (BoolLogic) CCNot(a, b, c bool) bool {
+	return (a && b) != c
+}
+
+func (BoolLogic) Fredkin(a, b, c bool) (bool, bool) {
+	if a {
+		return c, b
+	}
+	return b, c
+}
+
+func (BoolLogic) Peres(a, b, c bool) (bool, bool) {
+	return a != b, (a && b) != c
+}
+
+func (BoolLogic) InversePeres(a, b, c bool) (bool, bool) {
+	b = a != b
+	return b, (a && b) != c
+}
+
+func (BoolLogic) MCNot(a []bool, b bool) bool {
+	for _, control := range a {
+		if !control {
+			return b
+		}
+	}
+	return !b
+}
+
+// FloatLogic is the hyperbolic paraboloid mapping on floats
+type FloatLogic[F Float] struct {
+}
+
+func (FloatLogic[F]) Cell(bit bool) F {
+	if bit {
+		return 1
+	}
+	return 0
+}
+
+func (FloatLogic[F]) Bit(a F) bool {
+	return a > 0.5
+}
+
+func (FloatLogic[F]) Not(a F) F {
+	return 1 - a
+}
+
+func (FloatLogic[F]) CNot(a, b F) F {
+	return (1-a)*b + (1-b)*a
+}
+
+func (FloatLogic[F]) CCNot(a, b, c F) F {
+	return (1-a*b)*c + (1-c)*a*b
+}
+
+func (FloatLogic[F]) Fredkin(a, b, c F) (F, F) {
+	return (1-a)*b + a*c, (1-a)*c + a*b
+}
+
+func (f FloatLogic[F]) Peres(a, b, c F) (F, F) {
+	return f.CNot(a, b), f.CCNot(a, b, c)
+}
+
+func (f FloatLogic[F]) InversePeres(a, b, c F) (F, F) {
+	b = f.CNot(a, b)
+	return b, f.CCNot(a, b, c)
+}
+
+func (f FloatLogic[F]) MCNot(a []F, b F) F {
+	p := F(1)
+	for _, control := range a {
+		p *= control
+	}
+	return f.CNot(p, b)
+}
+
+// DualLogic adapts a mapping with precision F to Logic
+type DualLogic[F Float] struct {
+	MappingOf[F]
+}
+
+func (DualLogic[F]) Cell(bit bool) DualOf[F] {
+	if bit {
+		return DualOf[F]{Val: 1.0}
+	}
+	return DualOf[F]{}
+}
+
+func (DualLogic[F]) Bit(a DualOf[F]) bool {
+	return a.Val > 0.5
+}
+
+// Clone clones the mapping so that it can be used by another worker, mappings
+// without a Clone method are assumed to be stateless
+func (d DualLogic[F]) Clone() Logic[DualOf[F]] {
+	if cloner, ok := d.MappingOf.(interface{ Clone() MappingOf[F] }); ok {
+		return DualLogic[F]{MappingOf: cloner.Clone()}
+	}
+	return d
+}
+
+// DeviceFloat32 is a device with float32 cells
+type DeviceFloat32 = DeviceOf[float32]
+
+// DeviceFloat64 is a device with float64 cells
+type DeviceFloat64 = DeviceOf[float64]
+
+// DeviceOf is a device with cells of type T
+type DeviceOf[T any] struct {
+	*Circuit
+	Memory   []T
+	Logic    Logic[T]
+	Schedule *Schedule
+	// Tracer is called for each gate, Execute ignores the Schedule when it is set
+	Tracer   Tracer[T]
+	controls []T
+	// logics and scratch hold the logic and the control buffer of each worker
+	// of scheduled, the logic is cloned once per schedule
+	scheduled *Schedule
+	logics    []Logic[T]
+	scratch   [][]T
+}
+
+// NewDevice creates a device for circuit with cells of type T
+func NewDevice[T any](c *Circuit, logic Logic[T]) DeviceOf[T] {
+	memory := make([]T, len(c.Wires))
+	for _, value := range c.Wires {
+		memory[value.Index] = logic.Cell(value.Nominal)
+	}
+	return DeviceOf[T]{
+		Circuit: c,
+		Memory:  memory,
+		Logic:   logic,
+	}
+}
+
+func (d *DeviceOf[T]) Reset() {
+	memory, logic := d.Memory, d.Logic
+	for _, value := range d.Wires {
+		memory[value.Index] = logic.Cell(value.Nominal)
+	}
+}
+
+func (d *DeviceOf[T]) SetBus(prefix string, values ...T) {
+	memory := d.Memory
+	for i, value := range values {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		s := d.Wires[name]
+		memory[s.Index] = value
+	}
+}
+
+func (d *DeviceOf[T]) Set(name string, value T) {
+	d.Memory[d.Wires[d.Resolve(name)].Index] = value
+}
+
+func (d *DeviceOf[T]) Get(name string) T {
+	return d.Memory[d.Wires[d.Resolve(name)].Index]
+}
+
+func (d *DeviceOf[T]) SetUint64(prefix string, value uint64) {
+	width, ok := d.Buses[prefix]
+	if !ok {
+		panic(fmt.Errorf("bus %s not found", prefix))
+	}
+	if width > 64 {
+		panic(fmt.Errorf("bus %s is larger than uint64", prefix))
+	}
+	memory, logic := d.Memory, d.Logic
+	for i := 0; i < int(width); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		memory[d.Wires[d.Resolve(name)].Index] = logic.Cell(value&1 == 1)
+		value >>= 1
+	}
+}
+
+func (d *DeviceOf[T]) Print(prefix string, count int) {
+	memory := d.Memory
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		var value interface{} = memory[d.Wires[d.Resolve(name)].Index]
+		if bit, ok := value.(bool); ok {
+			value = 0
+			if bit {
+				value = 1
+			}
+		}
+		fmt.Printf("%s=%v\n", name, value)
+	}
+}
+
+func (d *DeviceOf[T]) Uint64(prefix string) uint64 {
+	width, ok := d.Buses[prefix]
+	if !ok {
+		panic(fmt.Errorf("bus %s not found", prefix))
+	}
+	if width > 64 {
+		panic(fmt.Errorf("bus %s is larger than uint64", prefix))
+	}
+	var value uint64
+	memory, logic := d.Memory, d.Logic
+	for i := 0; i < int(width); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if logic.Bit(memory[d.Wires[d.Resolve(name)].Index]) {
+			value |= 1 << uint(i)
+		}
+	}
+	return value
+}
+
+// SetInt64 sets the bus to value in two's complement
+func (d *DeviceOf[T]) SetInt64(prefix string, value int64) {
+	d.SetUint64(prefix, uint64(value))
+}
+
+// Int64 reads the bus as a two's complement value
+func (d *DeviceOf[T]) Int64(prefix string) int64 {
+	return signExtend(d.Uint64(prefix), d.Buses[prefix])
+}
+
+func (d *DeviceOf[T]) String(prefix string) string {
+	width, ok := d.Buses[prefix]
+	if !ok {
+		panic(fmt.Errorf("bus %s not found", prefix))
+	}
+	value, memory, logic := make([]rune, width), d.Memory, d.Logic
+	for i := 0; i < int(width); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		if logic.Bit(memory[d.Wires[d.Resolve(name)].Index]) {
+			value[i] = '1'
+		} else {
+			value[i] = '0'
+		}
+	}
+	return string(value)
+}
+
+func (d *DeviceOf[T]) AllocateSlice(prefix string) []T {
+	count := int(d.Buses[prefix])
+	return make([]T, count)
+}
+
+func (d *DeviceOf[T]) GetSlice(prefix string, values []T) {
+	count, memory := int(d.Buses[prefix]), d.Memory
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		values[i] = memory[d.Wires[d.Resolve(name)].Index]
+	}
+}
+
+func (d *DeviceOf[T]) SetSlice(prefix string, values []T) {
+	count, memory := int(d.Buses[prefix]), d.Memory
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		memory[d.Wires[d.Resolve(name)].Index] = values[i]
+	}
+}
+
+// Store sets the bus to value
+func (d *DeviceOf[T]) Store(bus Bus, value uint64) {
+	bus.fits()
+	memory, logic := d.Memory, d.Logic
+	for _, index := range bus {
+		memory[index] = logic.Cell(value&1 == 1)
+		value >>= 1
+	}
+}
+
+// Load reads the bus
+func (d *DeviceOf[T]) Load(bus Bus) uint64 {
+	bus.fits()
+	var value uint64
+	memory, logic := d.Memory, d.Logic
+	for i, index := range bus {
+		if logic.Bit(memory[index]) {
+			value |= 1 << uint(i)
+		}
+	}
+	return value
+}
+
+// StoreSlice copies values to the bus
+func (d *DeviceOf[T]) StoreSlice(bus Bus, values []T) {
+	memory := d.Memory
+	for i, index := range bus {
+		memory[index] = values[i]
+	}
+}
+
+// LoadSlice copies the bus to values
+func (d *DeviceOf[T]) LoadSlice(bus Bus, values []T) {
+	memory := d.Memory
+	for i, index := range bus {
+		values[i] = memory[index]
+	}
+}
+
+// Bits formats the bus as a string of ones and zeros
+func (d *DeviceOf[T]) Bits(bus Bus) string {
+	value, memory, logic := make([]rune, len(bus)), d.Memory, d.Logic
+	for i, index := range bus {
+		if logic.Bit(memory[index]) {
+			value[i] = '1'
+		} else {
+			value[i] = '0'
+		}
+	}
+	return string(value)
+}
+
+func apply[T any](memory []T, logic Logic[T], gate *Gate, reverse bool, controls []T) []T {
+	taps := gate.Taps
+	switch gate.Type {
+	case GateTypeNot:
+		memory[taps[0]] = logic.Not(memory[taps[0]])
+	case GateTypeCNot:
+		memory[taps[1]] = logic.CNot(memory[taps[0]], memory[taps[1]])
+	case GateTypeCCNot:
+		memory[taps[2]] = logic.CCNot(memory[taps[0]], memory[taps[1]], memory[taps[2]])
+	case GateTypeFredkin:
+		memory[taps[1]], memory[taps[2]] = logic.Fredkin(memory[taps[0]], memory[taps[1]], memory[taps[2]])
+	case GateTypePeres:
+		if reverse {
+			memory[taps[1]], memory[taps[2]] = logic.InversePeres(memory[taps[0]], memory[taps[1]], memory[taps[2]])
+		} else {
+			memory[taps[1]], memory[taps[2]] = logic.Peres(memory[taps[0]], memory[taps[1]], memory[taps[2]])
+		}
+	case GateTypeMCNot:
+		target := len(taps) - 1
+		controls = controls[:0]
+		for i, control := range taps[:target] {
+			if gate.Negative != nil && gate.Negative[i] {
+				controls = append(controls, logic.Not(memory[control]))
+			} else {
+				controls = append(controls, memory[control])
+			}
+		}
+		memory[taps[target]] = logic.MCNot(controls, memory[taps[target]])
+	}
+	return controls
+}
+
+func (d *DeviceOf[T]) Apply(gate *Gate, reverse bool) {
+	d.controls = apply(d.Memory, d.Logic, gate, reverse, d.controls)
+}
+
+func (d *DeviceOf[T]) Execute(reverse bool) {
+	if d.Tracer != nil {
+		traceGates(d.Gates, d.Memory, reverse, d.Apply, d.Tracer)
+		return
+	}
+
+	if d.Schedule != nil {
+		workers := d.Schedule.Workers
+		if workers < 1 {
+			workers = 1
+		}
+		if d.scheduled != d.Schedule || len(d.logics) != workers {
+			d.scheduled = d.Schedule
+			d.logics, d.scratch = make([]Logic[T], workers), make([][]T, workers)
+			for i := range d.logics {
+				d.logics[i] = d.Logic
+				if cloner, ok := d.Logic.(interface{ Clone() Logic[T] }); ok && i > 0 {
+					d.logics[i] = cloner.Clone()
+				}
+			}
+		}
+		memory, logics, scratch := d.Memory, d.logics, d.scratch
+		d.Schedule.Run(reverse, func(worker int, gate *Gate) {
+			scratch[worker] = apply(memory, logics[worker], gate, reverse, scratch[worker])
+		})
+		return
+	}
+
+	if reverse {
+		for i := len(d.Gates) - 1; i >= 0; i-- {
+			d.Apply(&d.Gates[i], true)
+		}
+		return
+	}
+
+	for i := range d.Gates {
+		d.Apply(&d.Gates[i], false)
+	}
+}
@@ -4,27 +4,74 @@
 
 package main
 
-import "fmt"
+import "math/rand"
 
-type Mapping interface {
-	Not(a Dual) Dual
-	CNot(a, b Dual) Dual
-	CCNot(a, b, c Dual) Dual
+// MappingOf maps the gates onto dual numbers with precision F
+type MappingOf[F Float] interface {
+	Not(a DualOf[F]) DualOf[F]
+	CNot(a, b DualOf[F]) DualOf[F]
+	CCNot(a, b, c DualOf[F]) DualOf[F]
+	Fredkin(a, b, c DualOf[F]) (DualOf[F], DualOf[F])
+	Peres(a, b, c DualOf[F]) (DualOf[F], DualOf[F])
+	InversePeres(a, b, c DualOf[F]) (DualOf[F], DualOf[F])
+	MCNot(a []DualOf[F], b DualOf[F]) DualOf[F]
 }
 
-type HyperbolicParaboloidMapping struct {
+// Mapping maps the gates onto float32 dual numbers
+type Mapping = MappingOf[float32]
+
+// Mapping64 maps the gates onto float64 dual numbers
+type Mapping64 = MappingOf[float64]
+
+// HyperbolicParaboloid is the hyperbolic paraboloid mapping with precision F
+type HyperbolicParaboloid[F Float] struct {
 }
 
-func (h *HyperbolicParaboloidMapping) Not(a Dual) Dual {
-	return Sub(One, a)
+// HyperbolicParaboloidMapping is the float32 hyperbolic paraboloid mapping
+type HyperbolicParaboloidMapping = HyperbolicParaboloid[float32]
+
+// HyperbolicParaboloidMapping64 is the float64 hyperbolic paraboloid mapping
+type HyperbolicParaboloidMapping64 = HyperbolicParaboloid[float64]
+
+func (h *HyperbolicParaboloid[F]) Clone() MappingOf[F] {
+	return h
+}
+
+func (h *HyperbolicParaboloid[F]) Not(a DualOf[F]) DualOf[F] {
+	return Sub(DualOf[F]{Val: 1.0}, a)
 }
 
-func (h *HyperbolicParaboloidMapping) CNot(a, b Dual) Dual {
-	return Add(Mul(Sub(One, a), b), Mul(Sub(One, b), a))
+func (h *HyperbolicParaboloid[F]) CNot(a, b DualOf[F]) DualOf[F] {
+	one := DualOf[F]{Val: 1.0}
+	return Add(Mul(Sub(one, a), b), Mul(Sub(one, b), a))
 }
 
-func (h *HyperbolicParaboloidMapping) CCNot(a, b, c Dual) Dual {
-	return Add(Mul(Sub(One, Mul(a, b)), c), Mul(Mul(Sub(One, c), a), b))
+func (h *HyperbolicParaboloid[F]) CCNot(a, b, c DualOf[F]) DualOf[F] {
+	one := DualOf[F]{Val: 1.0}
+	return Add(Mul(Sub(one, Mul(a, b)), c), Mul(Mul(Sub(one, c), a), b))
+}
+
+func (h *HyperbolicParaboloid[F]) Fredkin(a, b, c DualOf[F]) (DualOf[F], DualOf[F]) {
+	one := DualOf[F]{Val: 1.0}
+	return Add(Mul(Sub(one, a), b), Mul(a, c)), Add(Mul(Sub(one, a), c), Mul(a, b))
+}
+
+func (h *HyperbolicParaboloid[F]) Peres(a, b, c DualOf[F]) (DualOf[F], DualOf[F]) {
+	return h.CNot(a, b), h.CCNot(a, b, c)
+}
+
+func (h *HyperbolicParaboloid[F]) InversePeres(a, b, c DualOf[F]) (DualOf[F], DualOf[F]) {
+	b = h.CNot(a, b)
+	return b, h.CCNot(a, b, c)
+}
+
+func (h *HyperbolicParaboloid[F]) MCNot(a []DualOf[F], b DualOf[F]) DualOf[F] {
+	one := DualOf[F]{Val: 1.0}
+	p := one
+	for _, control := range a {
+		p = Mul(p, control)
+	}
+	return Add(Mul(Sub(one, p), b), Mul(Sub(one, b), p))
 }
 
 type NeuralMapping struct {
@@ -32,7 +79,12 @@ type NeuralMapping struct {
 }
 
 func NewNeuralMapping() *NeuralMapping {
-	cNotNetwork := NewNetwork(2, 2, 1)
+	return NewNeuralMappingRand(nil)
+}
+
+// NewNeuralMappingRand trains the networks of the mapping with rnd
+func NewNeuralMappingRand(rnd *rand.Rand) *NeuralMapping {
+	cNotNetwork := NewNetworkRand(rnd, 2, 2, 1)
 	data := []TrainingData{
 		{
 			[]float32{0, 0}, []float32{0},
@@ -49,7 +101,7 @@ func NewNeuralMapping() *NeuralMapping {
 	}
 	cNotNetwork.Train(data, .001, .4, .6)
 
-	ccNotNetwork := NewNetwork(3, 3, 1)
+	ccNotNetwork := NewNetworkRand(rnd, 3, 3, 1)
 	data = []TrainingData{
 		{
 			[]float32{0, 0, 0}, []float32{0},
@@ -84,6 +136,13 @@ func NewNeuralMapping() *NeuralMapping {
 	}
 }
 
+func (n *NeuralMapping) Clone() Mapping {
+	return &NeuralMapping{
+		CNotNetwork:  n.CNotNetwork.Network.NewNetState(),
+		CCNotNetwork: n.CCNotNetwork.Network.NewNetState(),
+	}
+}
+
 func (n *NeuralMapping) Not(a Dual) Dual {
 	return Sub(One, a)
 }
@@ -103,166 +162,32 @@ func (n *NeuralMapping) CCNot(a, b, c Dual) Dual {
 	return n.CCNotNetwork.State[2][0]
 }
 
-type DeviceDual struct {
-	*Circuit
-	Memory  []Dual
-	Mapping Mapping
-}
-
-func (d *DeviceDual) Reset() {
-	memory := d.Memory
-	for _, value := range d.Wires {
-		if value.Nominal {
-			memory[value.Index] = Dual{Val: 1.0}
-		} else {
-			memory[value.Index] = Dual{Val: 0}
-		}
-	}
-}
-
-func (d *DeviceDual) SetBus(prefix string, values ...Dual) {
-	memory := d.Memory
-	for i, value := range values {
-		name := fmt.Sprintf("%s%d", prefix, i)
-		s := d.Wires[name]
-		memory[s.Index] = value
-	}
-}
-
-func (d *DeviceDual) Set(name string, value Dual) {
-	d.Memory[d.Wires[d.Resolve(name)].Index] = value
+func (n *NeuralMapping) Fredkin(a, b, c Dual) (Dual, Dual) {
+	b = n.CNot(c, b)
+	c = n.CCNot(a, b, c)
+	b = n.CNot(c, b)
+	return b, c
 }
 
-func (d *DeviceDual) Get(name string) Dual {
-	return d.Memory[d.Wires[d.Resolve(name)].Index]
-}
-
-func (d *DeviceDual) SetUint64(prefix string, value uint64) {
-	width, ok := d.Buses[prefix]
-	if !ok {
-		panic(fmt.Errorf("bus %s not found", prefix))
-	}
-	if width > 64 {
-		panic(fmt.Errorf("bus %s is larger than uint64", prefix))
-	}
-	memory := d.Memory
-	for i := 0; i < int(width); i++ {
-		name := fmt.Sprintf("%s%d", prefix, i)
-		s := d.Wires[d.Resolve(name)]
-		if value&1 == 0 {
-			memory[s.Index] = Dual{Val: 0}
-		} else {
-			memory[s.Index] = Dual{Val: 1.0}
-		}
-		value >>= 1
-	}
+func (n *NeuralMapping) Peres(a, b, c Dual) (Dual, Dual) {
+	return n.CNot(a, b), n.CCNot(a, b, c)
 }
 
-func (d *DeviceDual) Print(prefix string, count int) {
-	memory := d.Memory
-	for i := 0; i < count; i++ {
-		name := fmt.Sprintf("%s%d", prefix, i)
-		fmt.Printf("%s=%v\n", name, memory[d.Wires[d.Resolve(name)].Index])
-	}
+func (n *NeuralMapping) InversePeres(a, b, c Dual) (Dual, Dual) {
+	b = n.CNot(a, b)
+	return b, n.CCNot(a, b, c)
 }
 
-func (d *DeviceDual) Uint64(prefix string) uint64 {
-	width, ok := d.Buses[prefix]
-	if !ok {
-		panic(fmt.Errorf("bus %s not found", prefix))
-	}
-	if width > 64 {
-		panic(fmt.Errorf("bus %s is larger than uint64", prefix))
-	}
-	var value uint64
-	memory := d.Memory
-	for i := 0; i < int(width); i++ {
-		name, bit := fmt.Sprintf("%s%d", prefix, i), uint64(0)
-		if memory[d.Wires[d.Resolve(name)].Index].Val > 0.5 {
-			bit = 1
-		}
-		value = value | (bit << uint(i))
+func (n *NeuralMapping) MCNot(a []Dual, b Dual) Dual {
+	p := One
+	for _, control := range a {
+		p = Mul(p, control)
 	}
-	return value
+	return n.CNot(p, b)
 }
 
-func (d *DeviceDual) String(prefix string) string {
-	width, ok := d.Buses[prefix]
-	if !ok {
-		panic(fmt.Errorf("bus %s not found", prefix))
-	}
-	value, memory := make([]rune, width), d.Memory
-	for i := 0; i < int(width); i++ {
-		name := fmt.Sprintf("%s%d", prefix, i)
-		if memory[d.Wires[d.Resolve(name)].Index].Val > 0.5 {
-			value[i] = '1'
-		} else {
-			value[i] = '0'
-		}
-	}
-	return string(value)
-}
+// DeviceDual is a device with Dual cells
+type DeviceDual = DeviceOf[Dual]
 
-func (d *DeviceDual) AllocateSlice(prefix string) []Dual {
-	count := int(d.Buses[prefix])
-	return make([]Dual, count)
-}
-
-func (d *DeviceDual) GetSlice(prefix string, values []Dual) {
-	count, memory := int(d.Buses[prefix]), d.Memory
-	for i := 0; i < count; i++ {
-		name := fmt.Sprintf("%s%d", prefix, i)
-		values[i] = memory[d.Wires[d.Resolve(name)].Index]
-	}
-}
-
-func (d *DeviceDual) SetSlice(prefix string, values []Dual) {
-	count, memory := int(d.Buses[prefix]), d.Memory
-	for i := 0; i < count; i++ {
-		name := fmt.Sprintf("%s%d", prefix, i)
-		memory[d.Wires[d.Resolve(name)].Index] = values[i]
-	}
-}
-
-func (d *DeviceDual) Execute(reverse bool) {
-	memory, mapping := d.Memory, d.Mapping
-	not, cnot, ccnot := mapping.Not, mapping.CNot, mapping.CCNot
-
-	if reverse {
-		for i := len(d.Gates) - 1; i >= 0; i-- {
-			gate := d.Gates[i]
-			switch gate.Type {
-			case GateTypeNot:
-				a := memory[gate.Taps[0]]
-				memory[gate.Taps[0]] = not(a)
-			case GateTypeCNot:
-				a := memory[gate.Taps[0]]
-				b := memory[gate.Taps[1]]
-				memory[gate.Taps[1]] = cnot(a, b)
-			case GateTypeCCNot:
-				a := memory[gate.Taps[0]]
-				b := memory[gate.Taps[1]]
-				c := memory[gate.Taps[2]]
-				memory[gate.Taps[2]] = ccnot(a, b, c)
-			}
-		}
-		return
-	}
-
-	for _, gate := range d.Gates {
-		switch gate.Type {
-		case GateTypeNot:
-			a := memory[gate.Taps[0]]
-			memory[gate.Taps[0]] = not(a)
-		case GateTypeCNot:
-			a := memory[gate.Taps[0]]
-			b := memory[gate.Taps[1]]
-			memory[gate.Taps[1]] = cnot(a, b)
-		case GateTypeCCNot:
-			a := memory[gate.Taps[0]]
-			b := memory[gate.Taps[1]]
-			c := memory[gate.Taps[2]]
-			memory[gate.Taps[2]] = ccnot(a, b, c)
-		}
-	}
-}
+// DeviceDual64 is a device with Dual64 cells
+type DeviceDual64 = DeviceOf[Dual64]
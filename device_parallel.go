@@ -0,0 +1,245 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// Lanes is the number of input vectors simulated by a DeviceParallel
+const Lanes = 64
+
+// DeviceParallel is a DeviceBool where each wire holds one bit for each of
+// Lanes independent input vectors
+type DeviceParallel struct {
+	*Circuit
+	Memory   []uint64
+	Schedule *Schedule
+	// Tracer is called for each gate, Execute ignores the Schedule when it is set
+	Tracer Tracer[uint64]
+}
+
+func lanes(nominal bool) uint64 {
+	if nominal {
+		return ^uint64(0)
+	}
+	return 0
+}
+
+func (d *DeviceParallel) Reset() {
+	memory := d.Memory
+	for _, value := range d.Wires {
+		memory[value.Index] = lanes(value.Nominal)
+	}
+}
+
+func (d *DeviceParallel) Set(name string, value uint64) {
+	d.Memory[d.Wires[d.Resolve(name)].Index] = value
+}
+
+func (d *DeviceParallel) Get(name string) uint64 {
+	return d.Memory[d.Wires[d.Resolve(name)].Index]
+}
+
+func (d *DeviceParallel) width(prefix string) int {
+	width, ok := d.Buses[prefix]
+	if !ok {
+		panic(fmt.Errorf("bus %s not found", prefix))
+	}
+	if width > 64 {
+		panic(fmt.Errorf("bus %s is larger than uint64", prefix))
+	}
+	return int(width)
+}
+
+// SetUint64 sets the bus to value in every lane
+func (d *DeviceParallel) SetUint64(prefix string, value uint64) {
+	memory := d.Memory
+	for i := 0; i < d.width(prefix); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		memory[d.Wires[d.Resolve(name)].Index] = lanes(value&1 == 1)
+		value >>= 1
+	}
+}
+
+// SetLane sets the bus to value in one lane
+func (d *DeviceParallel) SetLane(prefix string, lane int, value uint64) {
+	memory, mask := d.Memory, uint64(1)<<uint(lane)
+	for i := 0; i < d.width(prefix); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		index := d.Wires[d.Resolve(name)].Index
+		if value&1 == 1 {
+			memory[index] |= mask
+		} else {
+			memory[index] &^= mask
+		}
+		value >>= 1
+	}
+}
+
+// counter holds the low bits of the lane numbers
+var counter = [...]uint64{
+	0xAAAAAAAAAAAAAAAA,
+	0xCCCCCCCCCCCCCCCC,
+	0xF0F0F0F0F0F0F0F0,
+	0xFF00FF00FF00FF00,
+	0xFFFF0000FFFF0000,
+	0xFFFFFFFF00000000,
+}
+
+// SetCounter sets the bus in lane i to start + i
+func (d *DeviceParallel) SetCounter(prefix string, start uint64) {
+	if start%Lanes != 0 {
+		for lane := 0; lane < Lanes; lane++ {
+			d.SetLane(prefix, lane, start+uint64(lane))
+		}
+		return
+	}
+	memory := d.Memory
+	for i := 0; i < d.width(prefix); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		value := lanes(start>>uint(i)&1 == 1)
+		if i < len(counter) {
+			value = counter[i]
+		}
+		memory[d.Wires[d.Resolve(name)].Index] = value
+	}
+}
+
+// Lane reads the bus in one lane
+func (d *DeviceParallel) Lane(prefix string, lane int) uint64 {
+	var value uint64
+	memory := d.Memory
+	for i := 0; i < d.width(prefix); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		bit := memory[d.Wires[d.Resolve(name)].Index] >> uint(lane) & 1
+		value |= bit << uint(i)
+	}
+	return value
+}
+
+// Any returns the lanes in which any wire of the bus is one
+func (d *DeviceParallel) Any(prefix string) uint64 {
+	width, ok := d.Buses[prefix]
+	if !ok {
+		panic(fmt.Errorf("bus %s not found", prefix))
+	}
+	var value uint64
+	memory := d.Memory
+	for i := 0; i < int(width); i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		value |= memory[d.Wires[d.Resolve(name)].Index]
+	}
+	return value
+}
+
+// Store sets the bus to value in every lane
+func (d *DeviceParallel) Store(bus Bus, value uint64) {
+	bus.fits()
+	memory := d.Memory
+	for _, index := range bus {
+		memory[index] = lanes(value&1 == 1)
+		value >>= 1
+	}
+}
+
+// StoreLane sets the bus to value in one lane
+func (d *DeviceParallel) StoreLane(bus Bus, lane int, value uint64) {
+	bus.fits()
+	memory, mask := d.Memory, uint64(1)<<uint(lane)
+	for _, index := range bus {
+		if value&1 == 1 {
+			memory[index] |= mask
+		} else {
+			memory[index] &^= mask
+		}
+		value >>= 1
+	}
+}
+
+// LoadLane reads the bus in one lane
+func (d *DeviceParallel) LoadLane(bus Bus, lane int) uint64 {
+	bus.fits()
+	var value uint64
+	memory := d.Memory
+	for i, index := range bus {
+		value |= memory[index] >> uint(lane) & 1 << uint(i)
+	}
+	return value
+}
+
+// StoreSlice copies values to the bus
+func (d *DeviceParallel) StoreSlice(bus Bus, values []uint64) {
+	memory := d.Memory
+	for i, index := range bus {
+		memory[index] = values[i]
+	}
+}
+
+// LoadSlice copies the bus to values
+func (d *DeviceParallel) LoadSlice(bus Bus, values []uint64) {
+	memory := d.Memory
+	for i, index := range bus {
+		values[i] = memory[index]
+	}
+}
+
+func (d *DeviceParallel) Apply(gate *Gate, reverse bool) {
+	memory := d.Memory
+	switch gate.Type {
+	case GateTypeNot:
+		memory[gate.Taps[0]] = ^memory[gate.Taps[0]]
+	case GateTypeCNot:
+		memory[gate.Taps[1]] ^= memory[gate.Taps[0]]
+	case GateTypeCCNot:
+		memory[gate.Taps[2]] ^= memory[gate.Taps[0]] & memory[gate.Taps[1]]
+	case GateTypeFredkin:
+		swap := (memory[gate.Taps[1]] ^ memory[gate.Taps[2]]) & memory[gate.Taps[0]]
+		memory[gate.Taps[1]] ^= swap
+		memory[gate.Taps[2]] ^= swap
+	case GateTypePeres:
+		a, b, c := gate.Taps[0], gate.Taps[1], gate.Taps[2]
+		if reverse {
+			memory[b] ^= memory[a]
+			memory[c] ^= memory[a] & memory[b]
+		} else {
+			memory[c] ^= memory[a] & memory[b]
+			memory[b] ^= memory[a]
+		}
+	case GateTypeMCNot:
+		target, active := len(gate.Taps)-1, ^uint64(0)
+		for i, control := range gate.Taps[:target] {
+			value := memory[control]
+			if gate.Negative != nil && gate.Negative[i] {
+				value = ^value
+			}
+			active &= value
+		}
+		memory[gate.Taps[target]] ^= active
+	}
+}
+
+func (d *DeviceParallel) Execute(reverse bool) {
+	if d.Tracer != nil {
+		traceGates(d.Gates, d.Memory, reverse, d.Apply, d.Tracer)
+		return
+	}
+
+	if d.Schedule != nil {
+		d.Schedule.Run(reverse, func(worker int, gate *Gate) {
+			d.Apply(gate, reverse)
+		})
+		return
+	}
+
+	if reverse {
+		for i := len(d.Gates) - 1; i >= 0; i-- {
+			d.Apply(&d.Gates[i], true)
+		}
+		return
+	}
+
+	for i := range d.Gates {
+		d.Apply(&d.Gates[i], false)
+	}
+}
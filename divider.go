@@ -0,0 +1,133 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// addDivider divides the wires n in place by a divisor of width bits with
+// restoring division. The function load xors the divisor into its wires,
+// controlled on the wire control unless control is empty. The quotient is in
+// new A wires and the remainder is in the low wires of n.
+func (c *Circuit) addDivider(n []string, width int, load func(control string, wires []string)) (quotient, remainder []string) {
+	quotient = make([]string, len(n))
+	for i := range quotient {
+		quotient[i] = c.AddWire("A", false)
+	}
+	extended := append([]string{}, n...)
+	for i := 0; i < width; i++ {
+		extended = append(extended, c.AddWire("Z", false))
+	}
+	divisor := make([]string, width+1)
+	for i := range divisor {
+		divisor[i] = c.AddWire("Z", false)
+	}
+	carry := c.AddWire("Z", false)
+
+	for i := len(n) - 1; i >= 0; i-- {
+		window, q := extended[i:i+width+1], quotient[i]
+		load("", divisor[:width])
+		c.addSubtractor(divisor, window, carry, "")
+		load("", divisor[:width])
+		c.AddGateCNot(window[width], q)
+		load(q, divisor[:width])
+		c.addAdder(divisor, window, carry, "")
+		load(q, divisor[:width])
+		c.AddGateNot(q)
+	}
+	return quotient, extended[:width]
+}
+
+// Divider computes Q = N / D and R = N % D with a restoring divider, N has
+// size bits and D has divisorSize bits. N is overwritten and D is unchanged.
+func Divider(size, divisorSize int) Circuit {
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("N", size, false)
+	circuit.AddBus("D", divisorSize, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("Z", 0, false)
+	circuit.AddBus("Q", 0, true)
+	circuit.AddBus("R", 0, true)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("N", "I")
+	circuit.AddAlias("D", "I")
+	circuit.AddAlias("D", "G")
+
+	n, err := circuit.busWires("N")
+	if err != nil {
+		panic(err)
+	}
+	d, err := circuit.busWires("D")
+	if err != nil {
+		panic(err)
+	}
+	quotient, remainder := circuit.addDivider(n, divisorSize, func(control string, wires []string) {
+		for i, wire := range wires {
+			if control == "" {
+				circuit.AddGateCNot(d[i], wire)
+			} else {
+				circuit.AddGateCCNot(control, d[i], wire)
+			}
+		}
+	})
+	for _, wire := range quotient {
+		circuit.AddAlias(wire, "Q")
+	}
+	for _, wire := range remainder {
+		circuit.AddAlias(wire, "R")
+	}
+
+	return circuit
+}
+
+// ModularReduction computes R = X % modulus for the constant modulus, the
+// quotient is the garbage G
+func ModularReduction(size int, modulus uint64) Circuit {
+	if modulus == 0 {
+		panic(fmt.Errorf("modulus must not be zero"))
+	}
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("X", size, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("Z", 0, false)
+	circuit.AddBus("Q", 0, true)
+	circuit.AddBus("R", 0, true)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("X", "I")
+
+	x, err := circuit.busWires("X")
+	if err != nil {
+		panic(err)
+	}
+	quotient, remainder := circuit.addDivider(x, bits.Len64(modulus), func(control string, wires []string) {
+		for i, wire := range wires {
+			if modulus&(1<<uint(i)) == 0 {
+				continue
+			}
+			if control == "" {
+				circuit.AddGateNot(wire)
+			} else {
+				circuit.AddGateCNot(control, wire)
+			}
+		}
+	})
+	for _, wire := range quotient {
+		circuit.AddAlias(wire, "Q")
+	}
+	circuit.AddAlias("Q", "G")
+	for _, wire := range remainder {
+		circuit.AddAlias(wire, "R")
+	}
+
+	return circuit
+}
@@ -11,86 +11,98 @@ var (
 	One  = Dual{Val: 1.0}
 )
 
-type Dual struct {
-	Val, Der float32
+// Float is a floating point precision
+type Float interface {
+	~float32 | ~float64
 }
 
-func Add(u, v Dual) Dual {
-	return Dual{
+// DualOf is a dual number with precision F
+type DualOf[F Float] struct {
+	Val, Der F
+}
+
+// Dual is a float32 dual number
+type Dual = DualOf[float32]
+
+// Dual64 is a float64 dual number
+type Dual64 = DualOf[float64]
+
+func Add[F Float](u, v DualOf[F]) DualOf[F] {
+	return DualOf[F]{
 		Val: u.Val + v.Val,
 		Der: u.Der + v.Der,
 	}
 }
 
-func Sub(u, v Dual) Dual {
-	return Dual{
+func Sub[F Float](u, v DualOf[F]) DualOf[F] {
+	return DualOf[F]{
 		Val: u.Val - v.Val,
 		Der: u.Der - v.Der,
 	}
 }
 
-func Mul(u, v Dual) Dual {
-	return Dual{
+func Mul[F Float](u, v DualOf[F]) DualOf[F] {
+	return DualOf[F]{
 		Val: u.Val * v.Val,
 		Der: u.Der*v.Val + u.Val*v.Der,
 	}
 }
 
-func Div(u, v Dual) Dual {
-	return Dual{
+func Div[F Float](u, v DualOf[F]) DualOf[F] {
+	return DualOf[F]{
 		Val: u.Val / v.Val,
 		Der: (u.Der*v.Val - u.Val*v.Der) / (v.Val * v.Val),
 	}
 }
 
-func Sin(d Dual) Dual {
-	return Dual{
-		Val: float32(math.Sin(float64(d.Val))),
-		Der: d.Der * float32(math.Cos(float64(d.Val))),
+func Sin[F Float](d DualOf[F]) DualOf[F] {
+	return DualOf[F]{
+		Val: F(math.Sin(float64(d.Val))),
+		Der: d.Der * F(math.Cos(float64(d.Val))),
 	}
 }
 
-func Cos(d Dual) Dual {
-	return Dual{
-		Val: float32(math.Cos(float64(d.Val))),
-		Der: -d.Der * float32(math.Sin(float64(d.Val))),
+func Cos[F Float](d DualOf[F]) DualOf[F] {
+	return DualOf[F]{
+		Val: F(math.Cos(float64(d.Val))),
+		Der: -d.Der * F(math.Sin(float64(d.Val))),
 	}
 }
 
-func Exp(d Dual) Dual {
-	return Dual{
-		Val: float32(math.Exp(float64(d.Val))),
-		Der: d.Der * float32(math.Exp(float64(d.Val))),
+func Exp[F Float](d DualOf[F]) DualOf[F] {
+	return DualOf[F]{
+		Val: F(math.Exp(float64(d.Val))),
+		Der: d.Der * F(math.Exp(float64(d.Val))),
 	}
 }
 
-func Sigmoid(d Dual) Dual {
+func Sigmoid[F Float](d DualOf[F]) DualOf[F] {
 	e := Exp(d)
-	return Div(e, Add(e, One))
+	return Div(e, Add(e, DualOf[F]{Val: 1.0}))
 }
 
-func Log(d Dual) Dual {
-	return Dual{
-		Val: float32(math.Log(float64(d.Val))),
+func Log[F Float](d DualOf[F]) DualOf[F] {
+	return DualOf[F]{
+		Val: F(math.Log(float64(d.Val))),
 		Der: d.Der / d.Val,
 	}
 }
 
-func Abs(d Dual) Dual {
-	var sign float32
-	val := float32(math.Abs(float64(d.Val)))
+func Abs[F Float](d DualOf[F]) DualOf[F] {
+	var sign F
+	val := F(math.Abs(float64(d.Val)))
 	if d.Val != 0.0 {
 		sign = d.Val / val
 	}
-	return Dual{
+	return DualOf[F]{
 		Val: val,
 		Der: d.Der * sign,
 	}
 }
 
-func Pow(d Dual, p float32) Dual {
-	return Dual{
-		Val: float32(math.Pow(float64(d.Val), float64(p))),
-		Der: p * d.Der * float32(math.Pow(float64(d.Val), float64(p-1.0))),
+func Pow[F Float](d DualOf[F], p F) DualOf[F] {
+	return DualOf[F]{
+		Val: F(math.Pow(float64(d.Val), float64(p))),
+		Der: p * d.Der * F(math.Pow(float64(d.Val), float64(p-1.0))),
 	}
 }
@@ -0,0 +1,152 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// ExhaustiveBits is the largest number of input bits checked exhaustively
+const ExhaustiveBits = 20
+
+// Ports maps the buses of one circuit onto the buses of another
+type Ports struct {
+	Inputs, Outputs map[string]string
+}
+
+type Counterexample struct {
+	Inputs      map[string]uint64
+	Left, Right map[string]uint64
+}
+
+func (c *Counterexample) String() string {
+	format := func(values map[string]uint64) string {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprintf("%s=%d", name, values[name])
+		}
+		return strings.Join(parts, " ")
+	}
+	return fmt.Sprintf("inputs: %s; left: %s; right: %s",
+		format(c.Inputs), format(c.Left), format(c.Right))
+}
+
+func Equivalent(a, b *Circuit, ports Ports, samples int) (*Counterexample, error) {
+	inputs := make([]string, 0, len(ports.Inputs))
+	for name := range ports.Inputs {
+		inputs = append(inputs, name)
+	}
+	sort.Strings(inputs)
+	outputs := make([]string, 0, len(ports.Outputs))
+	for name := range ports.Outputs {
+		outputs = append(outputs, name)
+	}
+	sort.Strings(outputs)
+
+	check := func(buses []string, mapping map[string]string) (int, error) {
+		bits := 0
+		for _, name := range buses {
+			left, ok := a.Buses[name]
+			if !ok {
+				return 0, fmt.Errorf("bus %s not found in left circuit", name)
+			}
+			right, ok := b.Buses[mapping[name]]
+			if !ok {
+				return 0, fmt.Errorf("bus %s not found in right circuit", mapping[name])
+			}
+			if left != right {
+				return 0, fmt.Errorf("bus %s has width %d but %s has width %d", name, left, mapping[name], right)
+			}
+			if left > 64 {
+				return 0, fmt.Errorf("bus %s is larger than uint64", name)
+			}
+			bits += int(left)
+		}
+		return bits, nil
+	}
+	bits, err := check(inputs, ports.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	_, err = check(outputs, ports.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	left, right := a.NewDeviceBool(), b.NewDeviceBool()
+	values := make(map[string]uint64, len(inputs))
+	test := func() *Counterexample {
+		left.Reset()
+		right.Reset()
+		for _, name := range inputs {
+			left.SetUint64(name, values[name])
+			right.SetUint64(ports.Inputs[name], values[name])
+		}
+		left.Execute(false)
+		right.Execute(false)
+		differ := false
+		for _, name := range outputs {
+			if left.Uint64(name) != right.Uint64(ports.Outputs[name]) {
+				differ = true
+				break
+			}
+		}
+		if !differ {
+			return nil
+		}
+		counterexample := Counterexample{
+			Inputs: make(map[string]uint64),
+			Left:   make(map[string]uint64),
+			Right:  make(map[string]uint64),
+		}
+		for name, value := range values {
+			counterexample.Inputs[name] = value
+		}
+		for _, name := range outputs {
+			counterexample.Left[name] = left.Uint64(name)
+			counterexample.Right[ports.Outputs[name]] = right.Uint64(ports.Outputs[name])
+		}
+		return &counterexample
+	}
+
+	if bits <= ExhaustiveBits {
+		for vector := uint64(0); vector < 1<<uint(bits); vector++ {
+			v := vector
+			for _, name := range inputs {
+				width := a.Buses[name]
+				values[name] = v & (1<<uint(width) - 1)
+				v >>= width
+			}
+			if counterexample := test(); counterexample != nil {
+				return counterexample, nil
+			}
+		}
+		return nil, nil
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < samples; i++ {
+		for _, name := range inputs {
+			width := a.Buses[name]
+			value := rnd.Uint64()
+			if width < 64 {
+				value &= 1<<uint(width) - 1
+			}
+			values[name] = value
+		}
+		if counterexample := test(); counterexample != nil {
+			return counterexample, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// addModularMultiplier returns r * constant mod modulus in new wires when the
+// wire control is one and r otherwise. The factor selected by control is
+// loaded into A wires which are restored after r is multiplied by it with
+// addProduct, then the product is reduced with addDivider and the quotient is
+// aliased to G.
+func (c *Circuit) addModularMultiplier(control string, r []string, constant, modulus uint64, full FullAdder, half HalfAdder) []string {
+	factor := make([]string, len(r))
+	for i := range factor {
+		factor[i] = c.AddWire("A", false)
+	}
+	start := c.loadFactor(control, factor, constant)
+	load := append([]Gate{}, c.Gates[start:]...)
+	product := c.addProduct(r, factor, SequentialReduction, full, half)
+	for i := len(load) - 1; i >= 0; i-- {
+		c.Gates = append(c.Gates, load[i].remap(nil))
+	}
+
+	quotient, remainder := c.addDivider(product, len(r), func(control string, wires []string) {
+		for i, wire := range wires {
+			if modulus&(1<<uint(i)) == 0 {
+				continue
+			}
+			if control == "" {
+				c.AddGateNot(wire)
+			} else {
+				c.AddGateCNot(control, wire)
+			}
+		}
+	})
+	for _, wire := range quotient {
+		c.AddAlias(wire, "G")
+	}
+	return remainder
+}
+
+// loadFactor xors constant into the zero wires when control is one and 1
+// otherwise, it returns the index of the first gate
+func (c *Circuit) loadFactor(control string, wires []string, constant uint64) int {
+	start := len(c.Gates)
+	if constant&1 == 1 {
+		c.AddGateNot(wires[0])
+	} else {
+		c.AddGateNot(wires[0])
+		c.AddGateCNot(control, wires[0])
+	}
+	for i := 1; i < len(wires); i++ {
+		if constant&(1<<uint(i)) != 0 {
+			c.AddGateCNot(control, wires[i])
+		}
+	}
+	return start
+}
+
+// ModularExponentiation computes P = base^X mod modulus for the constants
+// base and modulus by multiplying by base^(2^i) mod modulus controlled on
+// each bit i of X, the intermediate results are garbage
+func ModularExponentiation(xBits int, base, modulus uint64, full FullAdder, half HalfAdder) Circuit {
+	if modulus < 2 {
+		panic(fmt.Errorf("modulus must be at least 2"))
+	}
+	width := bits.Len64(modulus)
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("X", xBits, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("P", 0, true)
+	circuit.AddBus("Z", 0, false)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("X", "I")
+	circuit.AddAlias("X", "G")
+
+	x, err := circuit.busWires("X")
+	if err != nil {
+		panic(err)
+	}
+	power := base % modulus
+	var r []string
+	for i, control := range x {
+		if i > 0 {
+			power = power * power % modulus
+		}
+		if r == nil {
+			r = make([]string, width)
+			for j := range r {
+				r[j] = circuit.AddWire("A", false)
+			}
+			circuit.loadFactor(control, r, power)
+			continue
+		}
+		if power == 1 {
+			continue
+		}
+		product := circuit.addModularMultiplier(control, r, power, modulus, full, half)
+		for _, wire := range r {
+			circuit.AddAlias(wire, "G")
+		}
+		r = product
+	}
+	if r == nil {
+		r = make([]string, width)
+		for j := range r {
+			r[j] = circuit.AddWire("A", false)
+		}
+		circuit.AddGateNot(r[0])
+	}
+	for _, wire := range r {
+		circuit.AddAlias(wire, "P")
+	}
+
+	return circuit
+}
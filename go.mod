@@ -1,3 +1,5 @@
 module github.com/pointlander/janus
 
+go 1.18
+
 require github.com/alixaxel/pagerank v0.0.0-20160306110729-14bfb4c1d88c
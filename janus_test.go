@@ -5,9 +5,16 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -74,7 +81,6 @@ func TestMultiplier4xFloat32(t *testing.T) {
 func TestMultiplier4xDual(t *testing.T) {
 	circuit := Multiplier4()
 	test := func(mapping Mapping) {
-		rand.Seed(1)
 		device := circuit.NewDeviceDual(mapping)
 		for y := uint64(0); y < 16; y++ {
 			for x := uint64(0); x < 16; x++ {
@@ -103,7 +109,7 @@ func TestMultiplier4xDual(t *testing.T) {
 		}
 	}
 	test(&HyperbolicParaboloidMapping{})
-	test(NewNeuralMapping())
+	test(NewNeuralMappingRand(rand.New(rand.NewSource(1))))
 }
 
 func TestDual(t *testing.T) {
@@ -116,7 +122,7 @@ func TestDual(t *testing.T) {
 
 func TestMultiplier(t *testing.T) {
 	test := func(size int, full FullAdder, half HalfAdder) {
-		circuit := Multiplier(size, full, half)
+		circuit := Multiplier(size, size, full, half)
 		max := uint64(1)
 		for i := 0; i < size; i++ {
 			max *= 2
@@ -155,8 +161,7 @@ func TestMultiplier(t *testing.T) {
 }
 
 func TestNetwork(t *testing.T) {
-	rand.Seed(1)
-	network := NewNetwork(2, 2, 1)
+	network := NewNetworkRand(rand.New(rand.NewSource(1)), 2, 2, 1)
 	data := []TrainingData{
 		{
 			[]float32{0, 0}, []float32{0},
@@ -188,8 +193,7 @@ func TestNetwork(t *testing.T) {
 }
 
 func TestNetworkCCNOT(t *testing.T) {
-	rand.Seed(1)
-	network := NewNetwork(3, 3, 1)
+	network := NewNetworkRand(rand.New(rand.NewSource(1)), 3, 3, 1)
 	data := []TrainingData{
 		{
 			[]float32{0, 0, 0}, []float32{0},
@@ -231,3 +235,1526 @@ func TestNetworkCCNOT(t *testing.T) {
 		}
 	}
 }
+
+func TestReal(t *testing.T) {
+	circuit := Multiplier(4, 4, FullAdderA1, HalfAdderA1)
+	var buffer bytes.Buffer
+	err := circuit.WriteReal(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadReal(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(circuit.Buses, loaded.Buses) {
+		t.Fatal("buses differ", circuit.Buses, loaded.Buses)
+	}
+	if !reflect.DeepEqual(circuit.Wires, loaded.Wires) {
+		t.Fatal("wires differ")
+	}
+	if !reflect.DeepEqual(circuit.Aliases, loaded.Aliases) {
+		t.Fatal("aliases differ")
+	}
+	if !reflect.DeepEqual(circuit.Gates, loaded.Gates) {
+		t.Fatal("gates differ")
+	}
+	device := loaded.NewDeviceBool()
+	for y := uint64(0); y < 16; y++ {
+		for x := uint64(0); x < 16; x++ {
+			device.SetUint64("Y", y)
+			device.SetUint64("X", x)
+			device.Execute(false)
+			if r := device.Uint64("P"); r != x*y {
+				t.Fatalf("%d * %d != %d (%d)", x, y, r, x*y)
+			}
+			device.Reset()
+		}
+	}
+}
+
+func TestRealForeign(t *testing.T) {
+	source := `# toffoli with a constant target
+.version 1.0
+.numvars 3
+.variables a b c
+.inputs a b 0
+.outputs a b f
+.constants --0
+.garbage 11-
+.begin
+t3 a b c
+.end
+`
+	circuit, err := ReadReal(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if circuit.Buses["I"] != 2 || circuit.Buses["G"] != 2 || circuit.Buses["O"] != 1 {
+		t.Fatal("unexpected buses", circuit.Buses)
+	}
+	device := circuit.NewDeviceBool()
+	device.SetUint64("I", 3)
+	device.Execute(false)
+	if device.Uint64("O") != 1 {
+		t.Fatal("and should be 1")
+	}
+
+	_, err = ReadReal(strings.NewReader(strings.Replace(source, "t3 a b c", "t3 a b d", 1)))
+	if err == nil {
+		t.Fatal("unknown variable should fail")
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	ports := Ports{
+		Inputs:  map[string]string{"Y": "Y", "X": "X"},
+		Outputs: map[string]string{"P": "P"},
+	}
+	a, b := Multiplier(4, 4, FullAdderA1, HalfAdderA1), Multiplier4()
+	counterexample, err := Equivalent(&a, &b, ports, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counterexample != nil {
+		t.Fatal(counterexample)
+	}
+
+	a, b = Multiplier(12, 12, FullAdderA2, HalfAdderA2), Multiplier(12, 12, FullAdderA3, HalfAdderA3)
+	counterexample, err = Equivalent(&a, &b, ports, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counterexample != nil {
+		t.Fatal(counterexample)
+	}
+
+	a, b = Multiplier4(), Multiplier4()
+	b.Gates = b.Gates[:len(b.Gates)-1]
+	counterexample, err = Equivalent(&a, &b, ports, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counterexample == nil {
+		t.Fatal("circuits should differ")
+	}
+	y, x := counterexample.Inputs["Y"], counterexample.Inputs["X"]
+	if counterexample.Left["P"] != x*y || counterexample.Right["P"] == x*y {
+		t.Fatal("invalid counterexample", counterexample)
+	}
+
+	_, err = Equivalent(&a, &b, Ports{Inputs: map[string]string{"Y": "A"}}, 0)
+	if err == nil {
+		t.Fatal("mismatched widths should fail")
+	}
+}
+
+func TestFredkinPeres(t *testing.T) {
+	circuit := NewCircuit()
+	circuit.AddBus("W", 3, false)
+	circuit.AddGateFredkin("W0", "W1", "W2")
+	circuit.AddGatePeres("W2", "W0", "W1")
+	expected := func(w uint64) uint64 {
+		a, b, c := w&1, (w>>1)&1, (w>>2)&1
+		if a == 1 {
+			b, c = c, b
+		}
+		b, a = b^(c&a), a^c
+		return a | b<<1 | c<<2
+	}
+
+	boolean := circuit.NewDeviceBool()
+	float := circuit.NewDeviceFloat32()
+	hyperbolic := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	neural := circuit.NewDeviceDual(NewNeuralMappingRand(rand.New(rand.NewSource(1))))
+	devices := []Device{&boolean, &float, &hyperbolic, &neural}
+	for i, device := range devices {
+		for w := uint64(0); w < 8; w++ {
+			device.SetUint64("W", w)
+			device.Execute(false)
+			if r := device.Uint64("W"); r != expected(w) {
+				t.Fatalf("device %d: %d -> %d != %d", i, w, r, expected(w))
+			}
+			device.Execute(true)
+			if r := device.Uint64("W"); r != w {
+				t.Fatalf("device %d: reverse %d != %d", i, r, w)
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	err := circuit.WriteReal(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadReal(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(circuit.Gates, loaded.Gates) {
+		t.Fatal("gates differ")
+	}
+}
+
+func TestMultiplierPeres(t *testing.T) {
+	a, b := Multiplier(4, 4, FullAdderPeres, HalfAdderPeres), Multiplier4()
+	ports := Ports{
+		Inputs:  map[string]string{"Y": "Y", "X": "X"},
+		Outputs: map[string]string{"P": "P"},
+	}
+	counterexample, err := Equivalent(&a, &b, ports, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counterexample != nil {
+		t.Fatal(counterexample)
+	}
+
+	device := a.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for y := uint64(0); y < 16; y++ {
+		for x := uint64(0); x < 16; x++ {
+			device.SetUint64("Y", y)
+			device.SetUint64("X", x)
+			device.Execute(false)
+			device.Execute(true)
+			if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+				t.Fatal("should be zero")
+			}
+			device.Reset()
+		}
+	}
+}
+
+func TestReduction(t *testing.T) {
+	ports := Ports{
+		Inputs:  map[string]string{"Y": "Y", "X": "X"},
+		Outputs: map[string]string{"P": "P"},
+	}
+	for size := 1; size <= 7; size++ {
+		sequential := Multiplier(size, size, FullAdderA1, HalfAdderA1)
+		for _, reduction := range Reductions {
+			for _, adder := range Adders {
+				circuit := ReducedMultiplier(size, size, reduction.Reduction, adder.Full, adder.Half)
+				if err := circuit.Validate(); err != nil {
+					t.Fatal(reduction.Name, adder.Name, err)
+				}
+				counterexample, err := Equivalent(&circuit, &sequential, ports, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if counterexample != nil {
+					t.Fatal(reduction.Name, adder.Name, size, counterexample)
+				}
+			}
+		}
+	}
+
+	depth := func(reduction Reduction) int {
+		circuit := ReducedMultiplier(16, 16, reduction, FullAdderA1, HalfAdderA1)
+		return circuit.Depth()
+	}
+	sequential, wallace, dadda := depth(SequentialReduction), depth(WallaceReduction), depth(DaddaReduction)
+	if wallace >= sequential || dadda >= sequential {
+		t.Fatalf("tree depths %d and %d should be less than %d", wallace, dadda, sequential)
+	}
+
+	circuit := ReducedMultiplier(4, 4, DaddaReduction, FullAdderA1, HalfAdderA1)
+	device := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for y := uint64(0); y < 16; y++ {
+		for x := uint64(0); x < 16; x++ {
+			device.SetUint64("Y", y)
+			device.SetUint64("X", x)
+			device.Execute(false)
+			if p := device.Uint64("P"); p != y*x {
+				t.Fatalf("%d * %d = %d", y, x, p)
+			}
+			device.Execute(true)
+			if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+				t.Fatal("should be zero")
+			}
+			device.Reset()
+		}
+	}
+}
+
+func TestBennett(t *testing.T) {
+	multiplier := Multiplier(3, 3, FullAdderA1, HalfAdderA1)
+	circuit, err := Bennett(&multiplier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := circuit.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if circuit.Buses["G"] != 6 || circuit.Buses["P"] != 6 {
+		t.Fatalf("G has width %d and P has width %d", circuit.Buses["G"], circuit.Buses["P"])
+	}
+	ports := Ports{
+		Inputs:  map[string]string{"Y": "Y", "X": "X"},
+		Outputs: map[string]string{"P": "P"},
+	}
+	counterexample, err := Equivalent(&circuit, &multiplier, ports, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counterexample != nil {
+		t.Fatal(counterexample)
+	}
+
+	device := circuit.NewDeviceBool()
+	for g := uint64(0); g < 64; g++ {
+		device.SetUint64("G", g)
+		device.Execute(false)
+		if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+			t.Fatal("the ancilla should be uncomputed")
+		}
+		device.Reset()
+
+		device.SetUint64("P", 15)
+		device.SetUint64("G", g)
+		device.Execute(true)
+		y, x := device.Uint64("Y"), device.Uint64("X")
+		if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+			t.Fatal("the ancilla should be uncomputed")
+		}
+		if zero := device.Uint64("O") == 0; zero != (y*x == 15) {
+			t.Fatalf("%d * %d", y, x)
+		}
+		device.Reset()
+	}
+
+	dual := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	dual.SetUint64("P", 15)
+	dual.SetUint64("Y", 5)
+	dual.SetUint64("X", 3)
+	dual.Execute(true)
+	if dual.Uint64("O") != 0 || dual.Uint64("A") != 0 || dual.Uint64("Z") != 0 {
+		t.Fatal("5 * 3 should be 15")
+	}
+}
+
+func TestBooth(t *testing.T) {
+	test := func(circuit Circuit, xBits, yBits int) {
+		if err := circuit.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		device, dual := circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+		floats := circuit.NewDeviceFloat32()
+		for y := -int64(1) << uint(yBits-1); y < 1<<uint(yBits-1); y++ {
+			for x := -int64(1) << uint(xBits-1); x < 1<<uint(xBits-1); x++ {
+				device.SetInt64("Y", y)
+				device.SetInt64("X", x)
+				device.Execute(false)
+				if p := device.Int64("P"); p != y*x {
+					t.Fatalf("%d * %d != %d", y, x, p)
+				}
+				p, g := device.Int64("P"), device.Uint64("G")
+				device.Reset()
+
+				floats.SetInt64("Y", y)
+				floats.SetInt64("X", x)
+				floats.Execute(false)
+				if floats.Int64("P") != p {
+					t.Fatalf("%d * %d != %d", y, x, floats.Int64("P"))
+				}
+				floats.Reset()
+
+				dual.SetInt64("P", p)
+				dual.SetUint64("G", g)
+				dual.Execute(true)
+				if dual.Int64("Y") != y || dual.Int64("X") != x {
+					t.Fatal("reverse should recover", y, x)
+				}
+				if dual.Uint64("A") != 0 || dual.Uint64("Z") != 0 {
+					t.Fatal("should be zero")
+				}
+				dual.Reset()
+			}
+		}
+	}
+	for _, bits := range [][2]int{{1, 1}, {1, 3}, {2, 2}, {3, 2}, {4, 3}, {6, 5}} {
+		for _, reduction := range Reductions {
+			test(Booth(bits[0], bits[1], reduction.Reduction, FullAdderA1, HalfAdderA1), bits[0], bits[1])
+		}
+		test(Booth(bits[0], bits[1], SequentialReduction, FullAdderPeres, HalfAdderPeres), bits[0], bits[1])
+	}
+}
+
+func TestRectangular(t *testing.T) {
+	test := func(circuit Circuit, xBits, yBits int) {
+		if err := circuit.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if circuit.Buses["P"] != uint32(xBits+yBits) {
+			t.Fatalf("P has width %d", circuit.Buses["P"])
+		}
+		device := circuit.NewDeviceBool()
+		for y := uint64(0); y < 1<<uint(yBits); y++ {
+			for x := uint64(0); x < 1<<uint(xBits); x++ {
+				device.SetUint64("Y", y)
+				device.SetUint64("X", x)
+				device.Execute(false)
+				if p := device.Uint64("P"); p != y*x {
+					t.Fatalf("%d * %d != %d", y, x, p)
+				}
+				device.Execute(true)
+				if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+					t.Fatal("should be zero")
+				}
+				device.Reset()
+			}
+		}
+	}
+	for _, bits := range [][2]int{{1, 4}, {2, 5}, {5, 3}, {3, 6}} {
+		for _, reduction := range Reductions {
+			test(ReducedMultiplier(bits[0], bits[1], reduction.Reduction, FullAdderA1, HalfAdderA1), bits[0], bits[1])
+		}
+		test(Karatsuba(bits[0], bits[1], FullAdderA1, HalfAdderA1), bits[0], bits[1])
+	}
+}
+
+func TestRandomMultiplier(t *testing.T) {
+	gates := make(map[int]bool)
+	for seed := int64(1); seed <= 8; seed++ {
+		circuit, err := RandomMultiplier(4, 5, seed, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := circuit.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		other, err := RandomMultiplier(4, 5, seed, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(circuit.Gates, other.Gates) {
+			t.Fatal("the same seed should give the same circuit")
+		}
+		gates[len(circuit.Gates)] = true
+
+		device := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+		for y := uint64(0); y < 32; y++ {
+			for x := uint64(0); x < 16; x++ {
+				device.SetUint64("Y", y)
+				device.SetUint64("X", x)
+				device.Execute(false)
+				device.Execute(true)
+				if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+					t.Fatal("should be zero")
+				}
+				device.Reset()
+			}
+		}
+	}
+	if len(gates) < 2 {
+		t.Fatal("the seeds should give different circuits")
+	}
+
+	if _, err := RandomMultiplier(12, 12, 1, 256); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKaratsuba(t *testing.T) {
+	ports := Ports{
+		Inputs:  map[string]string{"Y": "Y", "X": "X"},
+		Outputs: map[string]string{"P": "P"},
+	}
+	for _, size := range []int{1, 4, 5, 6, 7, 8, 12} {
+		a, b := Karatsuba(size, size, FullAdderA1, HalfAdderA1), Multiplier(size, size, FullAdderA1, HalfAdderA1)
+		if err := a.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		counterexample, err := Equivalent(&a, &b, ports, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counterexample != nil {
+			t.Fatal(size, counterexample)
+		}
+	}
+
+	circuit := Karatsuba(5, 5, FullAdderA1, HalfAdderA1)
+	device := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for y := uint64(0); y < 32; y++ {
+		for x := uint64(0); x < 32; x++ {
+			device.SetUint64("Y", y)
+			device.SetUint64("X", x)
+			device.Execute(false)
+			if p := device.Uint64("P"); p != y*x {
+				t.Fatalf("%d * %d = %d", y, x, p)
+			}
+			device.Execute(true)
+			if device.Uint64("A") != 0 || device.Uint64("Z") != 0 {
+				t.Fatal("should be zero")
+			}
+			device.Reset()
+		}
+	}
+
+	g, p := NewBus(&circuit, "G"), NewBus(&circuit, "P")
+	ancillas := append(NewBus(&circuit, "A"), NewBus(&circuit, "Z")...)
+	forward, reverse := circuit.NewDeviceBool(), circuit.NewDeviceBool()
+	garbage := make([]bool, len(g))
+	for y := uint64(0); y < 32; y++ {
+		for x := uint64(0); x < 32; x++ {
+			forward.SetUint64("Y", y)
+			forward.SetUint64("X", x)
+			forward.Execute(false)
+			forward.LoadSlice(g, garbage)
+			reverse.StoreSlice(g, garbage)
+			reverse.Store(p, y*x)
+			reverse.Execute(true)
+			if reverse.Uint64("Y") != y || reverse.Uint64("X") != x {
+				t.Fatalf("%d * %d should be recovered from P and G", y, x)
+			}
+			for _, index := range ancillas {
+				if reverse.Memory[index] {
+					t.Fatalf("%d * %d ancilla should be zero", y, x)
+				}
+			}
+			forward.Reset()
+			reverse.Reset()
+		}
+	}
+}
+
+func TestDivider(t *testing.T) {
+	circuit := Divider(5, 3)
+	if err := circuit.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	device, dual := circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for n := uint64(0); n < 32; n++ {
+		for d := uint64(1); d < 8; d++ {
+			device.SetUint64("N", n)
+			device.SetUint64("D", d)
+			device.Execute(false)
+			if q, r := device.Uint64("Q"), device.Uint64("R"); q != n/d || r != n%d {
+				t.Fatalf("%d / %d = %d remainder %d", n, d, q, r)
+			}
+			if device.Uint64("D") != d || device.Uint64("Z") != 0 {
+				t.Fatal("divisor and ancilla should be restored")
+			}
+			device.Execute(true)
+			if device.Uint64("N") != n || device.Uint64("A") != 0 {
+				t.Fatal("reverse should restore n")
+			}
+			device.Reset()
+
+			dual.SetUint64("Q", n/d)
+			dual.SetUint64("R", n%d)
+			dual.SetUint64("G", d)
+			dual.Execute(true)
+			if dual.Uint64("N") != n || dual.Uint64("A") != 0 || dual.Uint64("Z") != 0 {
+				t.Fatal("reverse should recover n", n, d)
+			}
+			dual.Execute(false)
+			if q, r := dual.Uint64("Q"), dual.Uint64("R"); q != n/d || r != n%d {
+				t.Fatalf("%d / %d = %d remainder %d", n, d, q, r)
+			}
+			dual.Reset()
+		}
+	}
+
+	circuit = ModularReduction(6, 11)
+	if err := circuit.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	device, dual = circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for x := uint64(0); x < 64; x++ {
+		device.SetUint64("X", x)
+		device.Execute(false)
+		if r, q := device.Uint64("R"), device.Uint64("G"); r != x%11 || q != x/11 {
+			t.Fatalf("%d mod 11 = %d quotient %d", x, r, q)
+		}
+		if device.Uint64("Z") != 0 {
+			t.Fatal("ancilla should be restored")
+		}
+		device.Reset()
+
+		dual.SetUint64("R", x%11)
+		dual.SetUint64("G", x/11)
+		dual.Execute(true)
+		if dual.Uint64("X") != x || dual.Uint64("A") != 0 || dual.Uint64("Z") != 0 {
+			t.Fatal("reverse should recover x", x)
+		}
+		dual.Reset()
+	}
+}
+
+func TestComparator(t *testing.T) {
+	circuit := Comparator(4)
+	if err := circuit.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	device := circuit.NewDeviceBool()
+	for a := uint64(0); a < 16; a++ {
+		for b := uint64(0); b < 16; b++ {
+			device.SetUint64("A", a)
+			device.SetUint64("B", b)
+			device.Execute(false)
+			if less := device.Get("L0"); less != (a < b) {
+				t.Fatalf("%d < %d != %t", a, b, less)
+			}
+			if equal := device.Get("E0"); equal != (a == b) {
+				t.Fatalf("%d == %d != %t", a, b, equal)
+			}
+			if device.Uint64("A") != a || device.Uint64("B") != b || device.Uint64("Z") != 0 {
+				t.Fatal("inputs and ancilla should be restored")
+			}
+			device.Execute(true)
+			if device.Get("L0") || device.Get("E0") {
+				t.Fatal("reverse should clear the outputs")
+			}
+			device.Reset()
+		}
+	}
+
+	multiplier := Multiplier(3, 3, FullAdderA1, HalfAdderA1)
+	multiplier.AddBus("K", 0, false)
+	multiplier.AddWire("K", true)
+	multiplier.AddWire("K", false)
+	multiplier.AddWire("K", false)
+	multiplier.AddWire("C", false)
+	multiplier.AddBus("L", 2, false)
+	multiplier.AddLessThan("K", "Y", "C", "L0")
+	multiplier.AddLessThan("K", "X", "C", "L1")
+	dual := multiplier.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for y := uint64(0); y < 8; y++ {
+		for x := uint64(0); x < 8; x++ {
+			dual.SetUint64("Y", y)
+			dual.SetUint64("X", x)
+			dual.Execute(false)
+			if l := dual.Uint64("L"); (l == 3) != (y > 1 && x > 1) {
+				t.Fatalf("%d and %d should be greater than 1: %d", y, x, l)
+			}
+			if dual.Uint64("P") != y*x || dual.Uint64("K") != 1 {
+				t.Fatal("product and constant should be unchanged")
+			}
+			dual.Reset()
+		}
+	}
+}
+
+func TestSquare(t *testing.T) {
+	for size := 1; size <= 6; size++ {
+		circuit := Square(size, FullAdderA1, HalfAdderA1)
+		if err := circuit.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		device := circuit.NewDeviceBool()
+		for x := uint64(0); x < 1<<uint(size); x++ {
+			device.SetUint64("X", x)
+			device.Execute(false)
+			if p := device.Uint64("P"); p != x*x {
+				t.Fatalf("%d * %d != %d", x, x, p)
+			}
+			device.Reset()
+		}
+	}
+
+	circuit := Square(4, FullAdderA1, HalfAdderA1)
+	device, dual := circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	garbage, found := uint64(1)<<circuit.Buses["G"], false
+	for g := uint64(0); g < garbage; g++ {
+		device.SetUint64("P", 49)
+		device.SetUint64("G", g)
+		device.Execute(true)
+		if device.Uint64("A") == 0 && device.Uint64("Z") == 0 {
+			if x := device.Uint64("X"); x != 7 {
+				t.Fatalf("the square root of 49 should be 7 not %d", x)
+			}
+			found = true
+		}
+		device.Reset()
+	}
+	if !found {
+		t.Fatal("the square root of 49 should be found")
+	}
+	for x := uint64(0); x < 16; x++ {
+		device.SetUint64("X", x)
+		device.Execute(false)
+		g := device.Uint64("G")
+		device.Reset()
+
+		dual.SetUint64("P", x*x)
+		dual.SetUint64("G", g)
+		dual.Execute(true)
+		if dual.Uint64("X") != x || dual.Uint64("A") != 0 || dual.Uint64("Z") != 0 {
+			t.Fatal("reverse should recover", x)
+		}
+		dual.Reset()
+	}
+}
+
+func TestModularExponentiation(t *testing.T) {
+	for _, test := range []struct {
+		bits          int
+		base, modulus uint64
+	}{
+		{0, 3, 7}, {3, 2, 2}, {4, 3, 7}, {4, 2, 15}, {5, 5, 23}, {4, 6, 9},
+	} {
+		circuit := ModularExponentiation(test.bits, test.base, test.modulus, FullAdderA1, HalfAdderA1)
+		if err := circuit.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		device, dual := circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+		power := uint64(1) % test.modulus
+		for x := uint64(0); x < 1<<uint(test.bits); x++ {
+			device.SetUint64("X", x)
+			device.Execute(false)
+			if p := device.Uint64("P"); p != power {
+				t.Fatalf("%d^%d mod %d = %d not %d", test.base, x, test.modulus, power, p)
+			}
+			garbage := make([]bool, circuit.Buses["G"])
+			for i := range garbage {
+				garbage[i] = device.Get(fmt.Sprintf("G%d", i))
+			}
+			device.Reset()
+
+			dual.SetUint64("P", power)
+			for i, value := range garbage {
+				if value {
+					dual.Set(fmt.Sprintf("G%d", i), Dual{Val: 1})
+				}
+			}
+			dual.Execute(true)
+			if dual.Uint64("X") != x {
+				t.Fatal("reverse should recover", x)
+			}
+			for i := 0; i < int(circuit.Buses["A"]); i++ {
+				if dual.Get(fmt.Sprintf("A%d", i)).Val != 0 {
+					t.Fatal("should be zero")
+				}
+			}
+			for i := 0; i < int(circuit.Buses["Z"]); i++ {
+				if dual.Get(fmt.Sprintf("Z%d", i)).Val != 0 {
+					t.Fatal("should be zero")
+				}
+			}
+			dual.Reset()
+			power = power * test.base % test.modulus
+		}
+	}
+}
+
+func TestDevice(t *testing.T) {
+	circuit := Booth(4, 4, SequentialReduction, FullAdderPeres, HalfAdderPeres)
+	boolean := NewDevice[bool](&circuit, BoolLogic{})
+	float := NewDevice[float64](&circuit, FloatLogic[float64]{})
+	neural := circuit.NewDeviceDual(NewNeuralMappingRand(rand.New(rand.NewSource(1))))
+	neural.Schedule = circuit.NewSchedule()
+	neural.Schedule.Workers, neural.Schedule.Threshold = 4, 1
+	devices := []Device{&boolean, &float, &neural}
+	for i, device := range devices {
+		for y := int64(-8); y < 8; y++ {
+			for x := int64(-8); x < 8; x++ {
+				device.Reset()
+				device.SetInt64("Y", y)
+				device.SetInt64("X", x)
+				device.Execute(false)
+				if p := device.Int64("P"); p != y*x {
+					t.Fatalf("device %d: %d * %d != %d", i, y, x, p)
+				}
+				device.Execute(true)
+				if device.Int64("Y") != y || device.Int64("X") != x || device.Uint64("A") != 0 {
+					t.Fatalf("device %d: %d * %d should be restored", i, y, x)
+				}
+			}
+		}
+	}
+
+	logics := neural.logics
+	neural.Execute(false)
+	if len(logics) != 4 || &logics[0] != &neural.logics[0] {
+		t.Fatal("the logic of each worker should be cloned once")
+	}
+
+	reference := circuit.NewDeviceParallel()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 16; i++ {
+		for j := range boolean.Memory {
+			boolean.Memory[j] = rnd.Intn(2) == 1
+			reference.Memory[j] = lanes(boolean.Memory[j])
+		}
+		boolean.Execute(i&1 == 1)
+		reference.Execute(i&1 == 1)
+		for j, value := range boolean.Memory {
+			if reference.Memory[j] != lanes(value) {
+				t.Fatal("bool memory differs from the parallel device")
+			}
+		}
+	}
+}
+
+func TestPrecision(t *testing.T) {
+	circuit := ModularExponentiation(5, 3, 31, FullAdderA1, HalfAdderA1)
+	single, double := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{}), circuit.NewDeviceDual64(&HyperbolicParaboloidMapping64{})
+	float := circuit.NewDeviceFloat64()
+	x, p := NewBus(&circuit, "X"), NewBus(&circuit, "P")
+	overflows := 0
+	for i := uint64(0); i < 32; i++ {
+		single.Reset()
+		double.Reset()
+		float.Reset()
+		single.Store(x, i)
+		double.Store(x, i)
+		float.Store(x, i)
+		single.Memory[x[i%5]].Der = 1
+		double.Memory[x[i%5]].Der = 1
+		single.Execute(false)
+		double.Execute(false)
+		float.Execute(false)
+		expected := uint64(1)
+		for j := uint64(0); j < i; j++ {
+			expected = expected * 3 % 31
+		}
+		if single.Load(p) != expected || double.Load(p) != expected || float.Load(p) != expected {
+			t.Fatalf("3^%d mod 31 != %d", i, expected)
+		}
+		for _, index := range p {
+			if math.IsNaN(float64(single.Memory[index].Der)) {
+				overflows++
+			}
+			if der := double.Memory[index].Der; math.IsNaN(der) || math.IsInf(der, 0) {
+				t.Fatalf("3^%d mod 31 derivative overflows", i)
+			}
+		}
+	}
+	if overflows == 0 {
+		t.Fatal("float32 derivatives should overflow")
+	}
+}
+
+func TestDeviceParallel(t *testing.T) {
+	fredkin := NewCircuit()
+	fredkin.AddBus("W", 4, false)
+	fredkin.AddGateFredkin("W0", "W1", "W2")
+	fredkin.AddGatePeres("W2", "W0", "W3")
+	fredkin.AddGateMCNot("-W0", "W3", "W1")
+	fredkin.AddGateNot("W2")
+	circuits := []Circuit{
+		fredkin,
+		Multiplier(3, 4, FullAdderPeres, HalfAdderPeres),
+		Booth(3, 3, SequentialReduction, FullAdderA2, HalfAdderA2),
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for _, circuit := range circuits {
+		circuit := circuit
+		device, parallel := circuit.NewDeviceBool(), circuit.NewDeviceParallel()
+		for _, reverse := range []bool{false, true} {
+			for i := range parallel.Memory {
+				parallel.Memory[i] = rnd.Uint64()
+			}
+			initial := append([]uint64{}, parallel.Memory...)
+			parallel.Execute(reverse)
+			for lane := 0; lane < Lanes; lane++ {
+				for i := range device.Memory {
+					device.Memory[i] = initial[i]>>uint(lane)&1 == 1
+				}
+				device.Execute(reverse)
+				for i, value := range device.Memory {
+					if (parallel.Memory[i]>>uint(lane)&1 == 1) != value {
+						t.Fatalf("lane %d wire %d differs", lane, i)
+					}
+				}
+			}
+		}
+	}
+
+	circuit := Multiplier(4, 4, FullAdderA1, HalfAdderA1)
+	device := circuit.NewDeviceParallel()
+	device.SetCounter("I", 0)
+	device.Execute(false)
+	for lane := 0; lane < Lanes; lane++ {
+		y, x := device.Lane("Y", lane), device.Lane("X", lane)
+		if uint64(lane) != y|x<<4 || device.Lane("P", lane) != y*x {
+			t.Fatalf("%d * %d != %d", y, x, device.Lane("P", lane))
+		}
+	}
+	device.Execute(true)
+	if ancilla := device.Any("A") | device.Any("Z"); ancilla != 0 {
+		t.Fatal("should be zero")
+	}
+	device.SetCounter("I", 3)
+	device.SetLane("P", 5, 42)
+	for lane := 0; lane < Lanes; lane++ {
+		if device.Lane("I", lane) != uint64(lane+3) {
+			t.Fatal("lane", lane, "should count from 3")
+		}
+	}
+	if device.Lane("P", 5) != 42 {
+		t.Fatal("lane 5 should be set")
+	}
+}
+
+func TestBus(t *testing.T) {
+	circuit := Multiplier(3, 4, FullAdderA1, HalfAdderA1)
+	y, x, p, i := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P"), NewBus(&circuit, "I")
+	if len(i) != 7 || i[0] != y[0] || i[4] != x[0] {
+		t.Fatal("alias bus I should resolve to Y and X")
+	}
+	boolean, dual, parallel := circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{}), circuit.NewDeviceParallel()
+	for a := uint64(0); a < 16; a++ {
+		for b := uint64(0); b < 8; b++ {
+			boolean.Store(y, a)
+			boolean.Store(x, b)
+			dual.Store(y, a)
+			dual.Store(x, b)
+			parallel.StoreLane(y, int(a), a)
+			parallel.StoreLane(x, int(a), b)
+			boolean.Execute(false)
+			dual.Execute(false)
+			parallel.Execute(false)
+			if boolean.Load(p) != a*b || boolean.Uint64("P") != a*b {
+				t.Fatalf("bool %d * %d != %d", a, b, boolean.Load(p))
+			}
+			if dual.Load(p) != a*b || dual.Bits(i) != dual.String("I") {
+				t.Fatalf("dual %d * %d != %d", a, b, dual.Load(p))
+			}
+			if parallel.LoadLane(p, int(a)) != parallel.Lane("P", int(a)) || parallel.LoadLane(p, int(a)) != a*b {
+				t.Fatalf("parallel %d * %d != %d", a, b, parallel.LoadLane(p, int(a)))
+			}
+			boolean.Reset()
+			dual.Reset()
+			parallel.Reset()
+		}
+	}
+
+	values, inputs := make([]bool, len(i)), make([]Dual, len(i))
+	boolean.Store(i, 0x55)
+	boolean.LoadSlice(i, values)
+	for j, value := range values {
+		if value {
+			inputs[j] = One
+		}
+	}
+	dual.StoreSlice(i, inputs)
+	if dual.Uint64("I") != 0x55 {
+		t.Fatal("slices should round trip")
+	}
+
+	for _, prefix := range []string{"Q", "W"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("bus", prefix, "should not resolve")
+				}
+			}()
+			broken := Multiplier(3, 4, FullAdderA1, HalfAdderA1)
+			broken.Buses["W"] = 2
+			NewBus(&broken, prefix)
+		}()
+	}
+}
+
+func TestTrace(t *testing.T) {
+	circuit := Booth(3, 3, SequentialReduction, FullAdderPeres, HalfAdderPeres)
+	boolean, dual := circuit.NewDeviceBool(), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	parallel, reference := circuit.NewDeviceParallel(), circuit.NewDeviceParallel()
+	traces := []*Trace{NewTrace(&circuit), NewTrace(&circuit), NewTrace(&circuit)}
+	boolean.Tracer = TraceBool(traces[0])
+	dual.Tracer = TraceDual[float32](traces[1])
+	parallel.Tracer = TraceParallel(traces[2])
+	traces[1].Latest = true
+	boolean.SetInt64("Y", -3)
+	boolean.SetInt64("X", 2)
+	boolean.Execute(false)
+	if boolean.Int64("P") != -6 {
+		t.Fatal("-3 * 2 should be -6")
+	}
+	boolean.Execute(true)
+	dual.Execute(false)
+	dual.Execute(true)
+	parallel.SetCounter("I", 0)
+	reference.SetCounter("I", 0)
+	parallel.Execute(false)
+	reference.Execute(false)
+	if !reflect.DeepEqual(parallel.Memory, reference.Memory) {
+		t.Fatal("tracing should not change the result")
+	}
+
+	if len(traces[0].Steps) != 2*len(circuit.Gates) || len(traces[1].Steps) != len(circuit.Gates) {
+		t.Fatal("there should be a step for each gate")
+	}
+	if step := traces[1].Steps[0]; !step.Reverse || int(step.Gate) != len(circuit.Gates)-1 {
+		t.Fatal("the latest trace should be in reverse")
+	}
+	for _, trace := range traces {
+		var buffer bytes.Buffer
+		err := trace.Write(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := ReadTrace(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded.Latest = trace.Latest
+		if !reflect.DeepEqual(trace, loaded) {
+			t.Fatal("trace differs")
+		}
+	}
+
+	trace := traces[0]
+	step := trace.Steps[len(circuit.Gates)-1]
+	for i, tap := range trace.Gates[step.Gate].Taps {
+		if value := boolean.Memory[tap]; step.Before[i].Val == 1 != value {
+			t.Fatal("the first reverse step should start from the product")
+		}
+	}
+	selected, err := trace.Select("Y", "P1", "A0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 5 {
+		t.Fatal("Y, P1 and A0 should select 5 wires", len(selected))
+	}
+	if _, err := trace.Select("Q"); err == nil {
+		t.Fatal("Q should not be found")
+	}
+
+	var out bytes.Buffer
+	err = trace.Replay(strings.NewReader("n\np\ng 1\nq\nn\n"), &out, selected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "step ") {
+			steps = append(steps, strings.Fields(line)[1])
+		}
+	}
+	first := -1
+	for i := range trace.Steps {
+		for _, tap := range trace.Gates[trace.Steps[i].Gate].Taps {
+			if selected[tap] && first < 0 {
+				first = i
+			}
+		}
+	}
+	expected := fmt.Sprintf("%d/%d", first, len(trace.Steps))
+	if len(steps) != 4 || steps[0] != expected || steps[2] != expected || steps[3] != fmt.Sprintf("1/%d", len(trace.Steps)) {
+		t.Fatal("unexpected replay", steps)
+	}
+
+	// headers that claim 2^30 names, gates or steps followed by nothing
+	for _, counts := range [][]uint64{{1 << 30}, {0, 0, 1 << 30}, {0, 0, 0, 1 << 30}} {
+		var buffer bytes.Buffer
+		compressed := gzip.NewWriter(&buffer)
+		header := append([]byte(traceMagic), byte(TraceKindDual))
+		for _, count := range counts {
+			var varint [binary.MaxVarintLen64]byte
+			header = append(header, varint[:binary.PutUvarint(varint[:], count)]...)
+		}
+		if _, err := compressed.Write(header); err != nil {
+			t.Fatal(err)
+		}
+		if err := compressed.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadTrace(&buffer); err == nil {
+			t.Fatal("a truncated trace should not be read", counts)
+		}
+	}
+}
+
+func TestMCNot(t *testing.T) {
+	circuit := NewCircuit()
+	circuit.AddBus("W", 6, false)
+	circuit.AddGateMCNot("W0", "-W1", "W2", "-W3", "W4", "W5")
+	circuit.AddGateMCNot("-W5", "W0")
+	circuit.AddGateMCNot("W1", "W2", "W3")
+	if circuit.Gates[2].Type != GateTypeCCNot {
+		t.Fatal("positive gate with two controls should be a CCNot")
+	}
+	expected := func(w uint64) uint64 {
+		if w&0x1f == 0x15 {
+			w ^= 1 << 5
+		}
+		if w&(1<<5) == 0 {
+			w ^= 1
+		}
+		if w&0x6 == 0x6 {
+			w ^= 1 << 3
+		}
+		return w
+	}
+
+	boolean := circuit.NewDeviceBool()
+	float := circuit.NewDeviceFloat32()
+	hyperbolic := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	neural := circuit.NewDeviceDual(NewNeuralMappingRand(rand.New(rand.NewSource(1))))
+	devices := []Device{&boolean, &float, &hyperbolic, &neural}
+	for i, device := range devices {
+		for w := uint64(0); w < 64; w++ {
+			device.SetUint64("W", w)
+			device.Execute(false)
+			if r := device.Uint64("W"); r != expected(w) {
+				t.Fatalf("device %d: %d -> %d != %d", i, w, r, expected(w))
+			}
+			device.Execute(true)
+			if r := device.Uint64("W"); r != w {
+				t.Fatalf("device %d: reverse %d != %d", i, r, w)
+			}
+		}
+	}
+
+	var buffer bytes.Buffer
+	err := circuit.WriteReal(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadReal(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(circuit.Gates, loaded.Gates) {
+		t.Fatal("gates differ", circuit.Gates, loaded.Gates)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	circuit := Multiplier4()
+	report := circuit.Analyze()
+	if report.Counts[GateTypeCCNot] != 36 || report.Counts[GateTypeCNot] != 20 || report.Gates != 56 {
+		t.Fatal("unexpected gate counts", report.Counts)
+	}
+	if report.QuantumCost != 36*5+20 {
+		t.Fatal("unexpected quantum cost", report.QuantumCost)
+	}
+	if report.Wires != 36 || report.Ancilla != 28 || report.Garbage != 28 {
+		t.Fatal("unexpected wire counts", report.Wires, report.Ancilla, report.Garbage)
+	}
+	if len(report.Buses) != 7 || report.Buses[0] != (BusReport{Name: "A", Width: 16}) ||
+		report.Buses[3] != (BusReport{Name: "P", Width: 8, Alias: true}) {
+		t.Fatal("unexpected buses", report.Buses)
+	}
+
+	circuit = NewCircuit()
+	circuit.AddBus("W", 4, false)
+	circuit.AddGateCNot("W0", "W1")
+	circuit.AddGateCNot("W2", "W3")
+	circuit.AddGateCCNot("W0", "W1", "W2")
+	circuit.AddGateMCNot("W0", "W1", "W2", "W3")
+	report = circuit.Analyze()
+	if report.Depth != 3 || report.QuantumCost != 1+1+5+13 {
+		t.Fatal("unexpected depth or cost", report.Depth, report.QuantumCost)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	circuit := NewCircuit()
+	circuit.AddBus("W", 4, false)
+	circuit.AddGateCNot("W0", "W1")
+	circuit.AddGateCCNot("W0", "W1", "W2")
+	circuit.AddGateCCNot("W0", "W1", "W2")
+	circuit.AddGateCNot("W0", "W1")
+	if gates := CancelPass(circuit.Gates); len(gates) != 0 {
+		t.Fatal("gates should cancel", gates)
+	}
+
+	circuit.Gates = nil
+	circuit.AddGateCNot("W0", "W1")
+	circuit.AddGateCNot("W0", "W2")
+	circuit.AddGateNot("W3")
+	circuit.AddGateCNot("W0", "W1")
+	if gates := CommutePass(circuit.Gates); len(gates) != 2 {
+		t.Fatal("gates should commute and cancel", gates)
+	}
+	circuit.AddGateCNot("W1", "W0")
+	circuit.AddGateCNot("W0", "W1")
+	if gates := CommutePass(circuit.Gates); len(gates) != 4 {
+		t.Fatal("gates should not commute", gates)
+	}
+
+	circuit.Gates = nil
+	circuit.AddGateCCNot("W0", "W1", "W2")
+	circuit.AddGateCNot("W1", "W0")
+	circuit.AddGateNot("W3")
+	circuit.AddGateCCNot("W3", "W1", "W2")
+	circuit.AddGateNot("W3")
+	gates := TemplatePass(circuit.Gates)
+	if len(gates) != 2 || gates[0].Type != GateTypePeres || gates[1].Type != GateTypeMCNot {
+		t.Fatal("templates should match", gates)
+	}
+	if !circuit.SameFunction(gates, 0) {
+		t.Fatal("templates should preserve function")
+	}
+	if circuit.SameFunction(gates[1:], 0) {
+		t.Fatal("function should differ")
+	}
+
+	for _, adder := range Adders {
+		a, b := Multiplier(4, 4, adder.Full, adder.Half), Multiplier(4, 4, adder.Full, adder.Half)
+		err := b.Optimize(1024, DefaultPasses...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b.Gates) >= len(a.Gates) && adder.Name != "Peres" {
+			t.Fatal("optimizer should remove gates", adder.Name)
+		}
+		if !a.SameFunction(b.Gates, 1024) {
+			t.Fatal("optimizer should preserve function", adder.Name)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	circuit := Multiplier(16, 16, FullAdderA1, HalfAdderA1)
+	circuit.AddGateMCNot("-Y0", "X1", "-Y2", "X3", "Z0")
+	circuit.AddGateFredkin("X0", "Y1", "Z1")
+	circuit.AddGatePeres("Y3", "X2", "Z2")
+	schedule := circuit.NewSchedule()
+	schedule.Workers, schedule.Threshold = 4, 1
+	count := 0
+	for _, layer := range schedule.Layers {
+		count += len(layer)
+	}
+	if count != len(circuit.Gates) {
+		t.Fatal("schedule should contain every gate")
+	}
+	if depth := circuit.Depth(); len(schedule.Layers) > depth {
+		t.Fatal("schedule should not be deeper than the circuit", len(schedule.Layers), depth)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 8; i++ {
+		y, x := uint64(rnd.Intn(1<<16)), uint64(rnd.Intn(1<<16))
+		a, b := circuit.NewDeviceBool(), circuit.NewDeviceBool()
+		b.Schedule = schedule
+		for _, device := range []*DeviceBool{&a, &b} {
+			device.SetUint64("Y", y)
+			device.SetUint64("X", x)
+			device.Execute(false)
+		}
+		if !reflect.DeepEqual(a.Memory, b.Memory) {
+			t.Fatal("bool memory differs")
+		}
+		for _, device := range []*DeviceBool{&a, &b} {
+			device.Execute(true)
+		}
+		if !reflect.DeepEqual(a.Memory, b.Memory) {
+			t.Fatal("bool memory differs in reverse")
+		}
+
+		c, d := circuit.NewDeviceFloat32(), circuit.NewDeviceFloat32()
+		d.Schedule = schedule
+		for j := range c.Memory {
+			c.Memory[j] = rnd.Float32()
+			d.Memory[j] = c.Memory[j]
+		}
+		c.Execute(false)
+		d.Execute(false)
+		if !reflect.DeepEqual(c.Memory, d.Memory) {
+			t.Fatal("float32 memory differs")
+		}
+
+		e, f := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{}), circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+		f.Schedule = schedule
+		for j := range e.Memory {
+			e.Memory[j] = Dual{Val: rnd.Float32(), Der: rnd.Float32()}
+			f.Memory[j] = e.Memory[j]
+		}
+		e.Execute(true)
+		f.Execute(true)
+		if !reflect.DeepEqual(e.Memory, f.Memory) {
+			t.Fatal("dual memory differs")
+		}
+	}
+
+	// a gate that writes a wire must not be scheduled before a gate that reads it
+	small := NewCircuit()
+	small.AddBus("W", 6, false)
+	small.AddGateCNot("W1", "W0")
+	small.AddGateCNot("W2", "W0")
+	small.AddGateCNot("W3", "W0")
+	small.AddGateCCNot("W0", "W4", "W5")
+	small.AddGateCNot("W4", "W1")
+	small.AddGateNot("W4")
+	circuits := []Circuit{small}
+	for i := 0; i < 64; i++ {
+		random := NewCircuit()
+		random.AddBus("W", 6, false)
+		for j := 0; j < 12; j++ {
+			w := rnd.Perm(6)
+			names := make([]string, 4)
+			for k := range names {
+				names[k] = fmt.Sprintf("W%d", w[k])
+			}
+			switch rnd.Intn(6) {
+			case 0:
+				random.AddGateNot(names[0])
+			case 1:
+				random.AddGateCNot(names[0], names[1])
+			case 2:
+				random.AddGateCCNot(names[0], names[1], names[2])
+			case 3:
+				random.AddGateFredkin(names[0], names[1], names[2])
+			case 4:
+				random.AddGatePeres(names[0], names[1], names[2])
+			case 5:
+				random.AddGateMCNot("-"+names[0], names[1], names[2], names[3])
+			}
+		}
+		circuits = append(circuits, random)
+	}
+	for i := range circuits {
+		circuit := &circuits[i]
+		for _, workers := range []int{1, 4} {
+			schedule := circuit.NewSchedule()
+			schedule.Workers, schedule.Threshold = workers, 1
+			for _, reverse := range []bool{false, true} {
+				for w := uint64(0); w < 64; w++ {
+					a, b := circuit.NewDeviceBool(), circuit.NewDeviceBool()
+					b.Schedule = schedule
+					a.SetUint64("W", w)
+					b.SetUint64("W", w)
+					a.Execute(reverse)
+					b.Execute(reverse)
+					if a.Uint64("W") != b.Uint64("W") {
+						t.Fatalf("circuit %d: %d scheduled %d != %d", i, w, b.Uint64("W"), a.Uint64("W"))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	builder := NewBuilder()
+	if err := builder.AddBus("Y", 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddBus("X", 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddBus("Y", 2, false); err == nil {
+		t.Fatal("duplicate bus should fail")
+	}
+	if _, err := builder.AddWire("Z", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.AddWire("Y0", false); err == nil {
+		t.Fatal("duplicate wire should fail")
+	}
+	if err := builder.AddGateCCNot("Y0", "Xl", "Z"); err == nil {
+		t.Fatal("misspelled wire should fail")
+	}
+	if err := builder.AddGateCCNot("Y0", "X1", "Y0"); err == nil {
+		t.Fatal("duplicate tap should fail")
+	}
+	if err := builder.AddGateMCNot("-Y0", "X1", "Y1", "Z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddBus("O", 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.AddAlias("Z", "O"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.AddAlias("Q", "O"); err == nil {
+		t.Fatal("alias of unknown wire should fail")
+	}
+	if aliases, err := builder.AddAlias("O0", "R"); err != nil || builder.Aliases[aliases[0]] != "Z" {
+		t.Fatal("alias of alias should resolve to the wire", err)
+	}
+	circuit, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(circuit.Gates) != 1 {
+		t.Fatal("failed gates should not be added")
+	}
+
+	circuit.Aliases["S"] = "T"
+	circuit.Aliases["T"] = "S"
+	if err := circuit.Validate(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatal("alias cycle should fail", err)
+	}
+	delete(circuit.Aliases, "S")
+	delete(circuit.Aliases, "T")
+	circuit.Gates = append(circuit.Gates, Gate{Type: GateTypeCNot, Taps: []uint32{1, 1}})
+	if err := circuit.Validate(); err == nil {
+		t.Fatal("duplicate tap should fail")
+	}
+
+	multiplier := Multiplier(4, 4, FullAdderA1, HalfAdderA1)
+	if err := multiplier.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("misspelled wire should panic")
+		}
+	}()
+	multiplier.AddGateCNot("Y0", "Xl")
+}
+
+func TestEmbed(t *testing.T) {
+	circuit := NewCircuit()
+	circuit.AddBus("A", 3, false)
+	circuit.AddBus("B", 3, false)
+	circuit.AddBus("C", 6, false)
+	first, second := Multiplier(3, 3, FullAdderA1, HalfAdderA1), Multiplier(6, 6, FullAdderPeres, HalfAdderPeres)
+	err := circuit.Embed(&first, "m", map[string]string{"Y": "A", "X": "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = circuit.Embed(&second, "n", map[string]string{"Y": "mP", "X": "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := circuit.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	err = circuit.Embed(&first, "m", map[string]string{"Y": "A", "X": "B"})
+	if err == nil {
+		t.Fatal("embedding twice with the same prefix should fail")
+	}
+
+	device := circuit.NewDeviceBool()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 256; i++ {
+		a, b, c := uint64(rnd.Intn(8)), uint64(rnd.Intn(8)), uint64(rnd.Intn(64))
+		device.SetUint64("A", a)
+		device.SetUint64("B", b)
+		device.SetUint64("C", c)
+		device.Execute(false)
+		if r := device.Uint64("nP"); r != a*b*c {
+			t.Fatalf("%d * %d * %d != %d", a, b, c, r)
+		}
+		device.Execute(true)
+		if device.Uint64("mA") != 0 || device.Uint64("nA") != 0 || device.Uint64("nZ") != 0 {
+			t.Fatal("should be zero")
+		}
+		device.Reset()
+	}
+}
+
+func TestInverse(t *testing.T) {
+	circuit := Multiplier(4, 4, FullAdderA1, HalfAdderA1)
+	err := circuit.Optimize(0, DefaultPasses...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverse := circuit.Inverse()
+	identity, err := Concatenate(&circuit, &inverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identity.Wires) != len(circuit.Wires) || len(identity.Gates) <= len(circuit.Gates) {
+		t.Fatal("concatenation should share wires")
+	}
+	if !identity.SameFunction(nil, 1024) {
+		t.Fatal("circuit followed by its inverse should be the identity")
+	}
+
+	device, reverse := circuit.NewDeviceBool(), inverse.NewDeviceBool()
+	for p := uint64(0); p < 256; p++ {
+		device.SetUint64("P", p)
+		device.Execute(true)
+		reverse.SetUint64("P", p)
+		reverse.Execute(false)
+		if !reflect.DeepEqual(device.Memory, reverse.Memory) {
+			t.Fatal("inverse should match reverse execution")
+		}
+		device.Reset()
+		reverse.Reset()
+	}
+}
+
+func TestRender(t *testing.T) {
+	circuit := Multiplier4()
+	circuit.AddGateMCNot("-Y0", "X1", "Z0")
+	circuit.AddGateFredkin("X0", "Y1", "Z1")
+	circuit.ComputeRanks()
+
+	var buffer bytes.Buffer
+	err := circuit.WriteDot(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := buffer.String()
+	if strings.Count(dot, "shape=box") != len(circuit.Gates) || !strings.Contains(dot, "style=dashed") {
+		t.Fatal("dot should contain every gate")
+	}
+
+	buffer.Reset()
+	err = circuit.WriteSVG(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := xml.NewDecoder(&buffer)
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCuccaro(t *testing.T) {
+	adder, subtractor := CuccaroAdder(4), CuccaroSubtractor(4)
+	a, s := adder.NewDeviceBool(), subtractor.NewDeviceBool()
+	for x := uint64(0); x < 16; x++ {
+		for y := uint64(0); y < 16; y++ {
+			a.SetUint64("A", x)
+			a.SetUint64("B", y)
+			a.Execute(false)
+			if r := a.Uint64("S"); r != x+y {
+				t.Fatalf("%d + %d != %d", x, y, r)
+			}
+			if a.Uint64("A") != x || a.Uint64("C") != 0 {
+				t.Fatal("a and carry should be restored")
+			}
+			a.Execute(true)
+			if a.Uint64("B") != y || a.Uint64("Z") != 0 {
+				t.Fatal("reverse should restore b")
+			}
+			a.Reset()
+
+			s.SetUint64("A", x)
+			s.SetUint64("B", y)
+			s.Execute(false)
+			if r := s.Uint64("S"); r != (y-x)&31 {
+				t.Fatalf("%d - %d != %d", y, x, r)
+			}
+			s.Reset()
+		}
+	}
+
+	device := adder.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for x := uint64(0); x < 16; x++ {
+		for y := uint64(0); y < 16; y++ {
+			device.SetUint64("S", x+y)
+			device.SetUint64("G", x)
+			device.Execute(true)
+			if device.Uint64("B") != y || device.Uint64("C") != 0 {
+				t.Fatal("reverse should recover b", x, y)
+			}
+			device.Reset()
+		}
+	}
+
+	circuit := Multiplier(3, 3, FullAdderA1, HalfAdderA1)
+	circuit.AddBus("R", 6, false)
+	circuit.AddWire("C", false)
+	circuit.AddAdder("R", "P", "C", "")
+	device = circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	for y := uint64(0); y < 8; y++ {
+		for x := uint64(0); x < 8; x++ {
+			device.SetUint64("Y", y)
+			device.SetUint64("X", x)
+			device.SetUint64("R", 5)
+			device.Execute(false)
+			if r := device.Uint64("P"); r != (x*y+5)&63 {
+				t.Fatalf("%d * %d + 5 != %d", x, y, r)
+			}
+			device.Reset()
+		}
+	}
+}
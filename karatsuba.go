@@ -0,0 +1,141 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+// KaratsubaCutoff is the size at and below which Karatsuba multiplies with
+// the schoolbook partial product array
+const KaratsubaCutoff = 4
+
+type karatsuba struct {
+	*Circuit
+	full  FullAdder
+	half  HalfAdder
+	zeros []string
+	// garbage holds the wires which aren't restored
+	garbage []string
+}
+
+// zero returns width wires which are zero before and after every adder, the
+// first zero wire is the carry of the adders
+func (k *karatsuba) zero(width int) []string {
+	for len(k.zeros) < width+1 {
+		k.zeros = append(k.zeros, k.AddWire("Z", false))
+	}
+	return k.zeros[1 : width+1]
+}
+
+func (k *karatsuba) add(a, b []string) {
+	a = append(append([]string{}, a...), k.zero(len(b)-len(a))...)
+	k.addAdder(a, b, k.zeros[0], "")
+}
+
+func (k *karatsuba) subtract(a, b []string) {
+	a = append(append([]string{}, a...), k.zero(len(b)-len(a))...)
+	k.addSubtractor(a, b, k.zeros[0], "")
+}
+
+// copy xors the wires into width new A wires, the copies are garbage
+func (k *karatsuba) copy(wires []string, width int) []string {
+	copied := make([]string, width)
+	for i := range copied {
+		copied[i] = k.AddWire("A", false)
+		if i < len(wires) {
+			k.AddGateCNot(wires[i], copied[i])
+		}
+	}
+	k.garbage = append(k.garbage, copied...)
+	return copied
+}
+
+// multiply returns the product of y and x from the three recursive products
+// low = y0*x0, high = y1*x1 and middle = (y0+y1)*(x0+x1) - low - high
+func (k *karatsuba) multiply(y, x []string) []string {
+	size := len(y)
+	if size <= KaratsubaCutoff {
+		return k.addProduct(y, x, SequentialReduction, k.full, k.half)
+	}
+	half := size / 2
+	low := k.multiply(y[:half], x[:half])
+	high := k.multiply(y[half:], x[half:])
+
+	sy, sx := k.copy(y[half:], size-half+1), k.copy(x[half:], size-half+1)
+	k.add(y[:half], sy)
+	k.add(x[:half], sx)
+	middle := k.multiply(sy, sx)
+	k.subtract(low, middle)
+	k.subtract(high, middle)
+	k.garbage = append(k.garbage, middle...)
+
+	product := append(low, high...)
+	k.add(middle, product[half:])
+	return product
+}
+
+// Karatsuba computes P = Y * X with the recursive Karatsuba multiplier, which
+// uses O(n^1.58) partial products instead of the n^2 of Multiplier. The
+// narrower of X and Y is extended with zero wires.
+func Karatsuba(xBits, yBits int, full FullAdder, half HalfAdder) Circuit {
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("Y", yBits, false)
+	circuit.AddBus("X", xBits, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("P", xBits+yBits, true)
+	circuit.AddBus("Z", 0, false)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("Y", "I")
+	circuit.AddAlias("X", "I")
+	circuit.AddAlias("Y", "G")
+	circuit.AddAlias("X", "G")
+
+	y, err := circuit.busWires("Y")
+	if err != nil {
+		panic(err)
+	}
+	x, err := circuit.busWires("X")
+	if err != nil {
+		panic(err)
+	}
+	k := karatsuba{
+		Circuit: &circuit,
+		full:    full,
+		half:    half,
+	}
+	for len(y) < len(x) {
+		y = append(y, circuit.AddWire("Z", false))
+	}
+	for len(x) < len(y) {
+		x = append(x, circuit.AddWire("Z", false))
+	}
+	product := k.multiply(y, x)
+	for i, output := range product[:xBits+yBits] {
+		circuit.AddAlias(output, fmt.Sprintf("P%d", i))
+	}
+
+	// the sums of the halves, the middle products and the high product wires
+	// are left set, so they are garbage unless they are already outputs
+	outputs := make(map[string]bool)
+	for _, bus := range []string{"P", "G"} {
+		wires, err := circuit.busWires(bus)
+		if err != nil {
+			panic(err)
+		}
+		for _, wire := range wires {
+			outputs[wire] = true
+		}
+	}
+	for _, wire := range append(k.garbage, product[xBits+yBits:]...) {
+		if !outputs[wire] {
+			outputs[wire] = true
+			circuit.AddAlias(wire, "G")
+		}
+	}
+
+	return circuit
+}
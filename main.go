@@ -7,28 +7,190 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
+	"strings"
 )
 
 var (
-	help   = flag.Bool("help", false, "prints help")
-	graph  = flag.Bool("graph", false, "graph the search space")
-	factor = flag.Uint("factor", 77, "number to factor")
-	all    = flag.Bool("all", false, "factor all numbers")
-	mode   = flag.String("mode", "forward", "factoring algorithm")
-	test   = flag.Bool("test", false, "test mode")
+	help       = flag.Bool("help", false, "prints help")
+	graph      = flag.Bool("graph", false, "graph the search space of a 4x4 multiplier unless -xbits or -ybits is given")
+	target     = flag.Uint("target", 225, "product the search space is graphed for")
+	factor     = flag.Uint("factor", 77, "number to factor")
+	power      = flag.Uint("power", 7, "power to find the discrete logarithm of in log mode")
+	all        = flag.Bool("all", false, "factor all numbers up to 225, or up to (2^xbits-1)*(2^ybits-1) if -xbits or -ybits is given")
+	mode       = flag.String("mode", "forward", "factoring algorithm")
+	test       = flag.Bool("test", false, "scan the garbage of a 4x4 multiplier for the factors of 81 unless -xbits, -ybits or -factor is given")
+	export     = flag.String("export", "", "write the multiplier to a RevLib .real file")
+	report     = flag.Bool("report", false, "print the cost of the multiplier for each adder")
+	optimize   = flag.Bool("optimize", false, "optimize the multiplier circuit")
+	workers    = flag.Int("workers", 0, "number of goroutines used to execute each layer of the circuit")
+	dot        = flag.String("dot", "", "write the multiplier dependency graph to a graphviz .dot file")
+	svg        = flag.String("svg", "", "write the multiplier circuit diagram to a .svg file")
+	reduction  = flag.String("reduction", "sequential", "partial product reduction: sequential, wallace or dadda")
+	multiplier = flag.String("multiplier", "schoolbook", "multiplier generator: schoolbook, karatsuba or random")
+	seed       = flag.Int64("seed", 1, "seed of the random multiplier")
+	base       = flag.Uint("base", 3, "base of the modular exponentiation in log mode")
+	modulus    = flag.Uint("modulus", 31, "modulus of the modular exponentiation in log mode")
+	xbits      = flag.Int("xbits", 5, "width of the factor X")
+	ybits      = flag.Int("ybits", 5, "width of the factor Y")
+	precision  = flag.Int("precision", 32, "precision of the dual numbers in bits, 32 or 64")
+	trace      = flag.String("trace", "", "write a trace of the last circuit execution of the search to a file")
+	replay     = flag.String("replay", "", "step through a trace file")
+	filter     = flag.String("filter", "", "comma separated wires and buses the replay stops at")
+	bennett    = flag.Bool("bennett", false, "uncompute the garbage of the multiplier so the only unknowns of reverse mode are the inputs")
 )
 
-func searchSpace() {
+// isSet returns true if the flag name was given on the command line
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// widths returns the widths of the factors, which are x and y unless
+// -xbits or -ybits is given
+func widths(x, y int) (int, int) {
+	if isSet("xbits") || isSet("ybits") {
+		return *xbits, *ybits
+	}
+	return x, y
+}
+
+// budget scales the iterations of a search tuned for a 4x4 multiplier to
+// the number of input bits, doubling them for every bit beyond 8
+func budget(iterations, bits int) int {
+	if bits > 8 {
+		return iterations << uint(bits-8)
+	}
+	return iterations
+}
+
+func newReduction(name string) Reduction {
+	for _, reduction := range Reductions {
+		if reduction.Name == name {
+			return reduction.Reduction
+		}
+	}
+	panic(fmt.Errorf("unknown reduction %s", name))
+}
+
+func newMultiplier(xBits, yBits int, full FullAdder, half HalfAdder) Circuit {
+	return newReducedMultiplier(xBits, yBits, newReduction(*reduction), full, half)
+}
+
+// newReducedMultiplier is newMultiplier with the partial product reduction
+// of the schoolbook multiplier given instead of taken from -reduction
+func newReducedMultiplier(xBits, yBits int, reduction Reduction, full FullAdder, half HalfAdder) Circuit {
+	var circuit Circuit
+	switch *multiplier {
+	case "schoolbook":
+		circuit = ReducedMultiplier(xBits, yBits, reduction, full, half)
+	case "karatsuba":
+		circuit = Karatsuba(xBits, yBits, full, half)
+	case "random":
+		var err error
+		circuit, err = RandomMultiplier(xBits, yBits, *seed, 1024)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic(fmt.Errorf("unknown multiplier %s", *multiplier))
+	}
+	if *bennett {
+		var err error
+		circuit, err = Bennett(&circuit)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if *optimize {
+		err := circuit.Optimize(1024, DefaultPasses...)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return circuit
+}
+
+// newSearchMultiplier returns the hand built Multiplier4 the reverse and
+// probabilistic searches were tuned on when the default 4x4 schoolbook
+// multiplier is asked for, and newMultiplier otherwise
+func newSearchMultiplier(xBits, yBits int) Circuit {
+	if xBits != 4 || yBits != 4 || *multiplier != "schoolbook" || *reduction != "sequential" || *bennett {
+		return newMultiplier(xBits, yBits, FullAdderA1, HalfAdderA1)
+	}
 	circuit := Multiplier4()
+	if *optimize {
+		err := circuit.Optimize(1024, DefaultPasses...)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return circuit
+}
+
+func newSchedule(circuit *Circuit) *Schedule {
+	if *workers < 2 {
+		return nil
+	}
+	schedule := circuit.NewSchedule()
+	schedule.Workers = *workers
+	return schedule
+}
+
+// traceSearch traces the last Execute of device if -trace is set, the returned
+// function writes the trace
+func traceSearch[F Float](circuit *Circuit, device *DeviceOf[DualOf[F]]) func() {
+	if *trace == "" {
+		return func() {}
+	}
+	t := NewTrace(circuit)
+	t.Latest = true
+	device.Tracer = TraceDual[F](t)
+	return func() {
+		file, err := os.Create(*trace)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+		err = t.Write(file)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ancilla returns the lanes in which any ancilla wire is not zero
+func ancilla(device *DeviceParallel) uint64 {
+	var value uint64
+	for _, bus := range []string{"A", "Z", "O"} {
+		if _, ok := device.Buses[bus]; ok {
+			value |= device.Any(bus)
+		}
+	}
+	return value
+}
+
+func searchSpace() {
+	xBits, yBits := widths(4, 4)
+	circuit := newMultiplier(xBits, yBits, FullAdderA1, HalfAdderA1)
 	circuit.ComputeRanks()
 	//circuit.PrintRanked()
 	//circuit.PrintConnections("A12")
 
-	device := circuit.NewDeviceBool()
-	target := 225
+	device := circuit.NewDeviceParallel()
+	yBus, xBus, pBus := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P")
+	target := int(*target)
+	if space := (1<<uint(xBits) - 1) * (1<<uint(yBits) - 1); target > space {
+		panic(fmt.Errorf("target must be [0,%d]", space))
+	}
 	file, err := os.Create("points.dat")
 	if err != nil {
 		panic(err)
@@ -39,30 +201,31 @@ func searchSpace() {
 		panic(err)
 	}
 	defer fileSimple.Close()
-	for y := uint64(0); y < 16; y++ {
-		for x := uint64(0); x < 16; x++ {
-			device.SetUint64("Y", y)
-			device.SetUint64("X", x)
-			device.Execute(false)
-			device.SetUint64("P", uint64(target))
-			device.Execute(true)
-			count := 0.0
-			for i := 0; i < 16; i++ {
-				name := fmt.Sprintf("A%d", i)
-				wire := device.Wires[device.Resolve(name)]
-				if device.Get(name) {
-					count += wire.Rank
-				}
-			}
-			for i := 0; i < 12; i++ {
-				name := fmt.Sprintf("Z%d", i)
+	width, total := uint64(1)<<uint(xBits), uint64(1)<<uint(xBits+yBits)
+	for start := uint64(0); start < total; start += Lanes {
+		for lane := 0; lane < Lanes; lane++ {
+			device.StoreLane(yBus, lane, (start+uint64(lane))/width)
+			device.StoreLane(xBus, lane, (start+uint64(lane))%width)
+		}
+		device.Execute(false)
+		device.Store(pBus, uint64(target))
+		device.Execute(true)
+		var counts [Lanes]float64
+		for _, bus := range []string{"A", "Z"} {
+			for i := 0; i < int(device.Buses[bus]); i++ {
+				name := fmt.Sprintf("%s%d", bus, i)
 				wire := device.Wires[device.Resolve(name)]
-				if device.Get(name) {
-					count += wire.Rank
+				for lane := 0; lane < Lanes; lane++ {
+					if device.Get(name)>>uint(lane)&1 == 1 {
+						counts[lane] += wire.Rank
+					}
 				}
 			}
-			device.Reset()
-			fmt.Fprintf(file, "%d %d %f\n", x, y, count)
+		}
+		device.Reset()
+		for lane := 0; lane < Lanes && start+uint64(lane) < total; lane++ {
+			y, x := (start+uint64(lane))/width, (start+uint64(lane))%width
+			fmt.Fprintf(file, "%d %d %f\n", x, y, counts[lane])
 			fitness := target - int(x*y)
 			if fitness < 0 {
 				fitness = -fitness
@@ -72,35 +235,28 @@ func searchSpace() {
 	}
 }
 
-func factorForward(size int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
-	max := uint64(1)
-	for i := 0; i < size; i++ {
-		max *= 2
-	}
-	iterations := 0
-	circuit := Multiplier(size, FullAdderA1, HalfAdderA1)
-	device := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
-	hill := func(target int, prefix string) Dual {
-		acc := Dual{Val: 1.0}
-		for i := 0; i < size; i++ {
-			value := device.Get(fmt.Sprintf("%s%d", prefix, i))
-			bit := target & 1
-			if bit == 1 {
-				acc = Mul(acc, value)
-			} else {
-				acc = Mul(acc, Sub(One, value))
-			}
-			target >>= 1
-		}
-		return acc
-	}
+// gradient searches the inputs of a dual number device for a state in
+// which the target bus holds value
+type gradient[F Float] struct {
+	device         *DeviceOf[DualOf[F]]
+	inputs, target Bus
+	value          uint64
+	// space is how often an input state can be revisited before it is left at random
+	space int
+	// cost adds to the cost of the target bus
+	cost func(cost DualOf[F]) DualOf[F]
+	// unknown treats a NaN derivative as unknown instead of ending the search
+	unknown bool
+	// print prints the buses of the device in log mode
+	print func()
+}
 
-	device.SetUint64("Y", uint64(rand.Intn(int(max))))
-	device.SetUint64("X", uint64(rand.Intn(int(max))))
-	inputs := device.AllocateSlice("I")
-	device.GetSlice("I", inputs)
+// search flips one input per iteration along the derivative of the cost
+func (g *gradient[F]) search(limit int, log bool) (found bool) {
+	device, iterations := g.device, 0
+	inputs := make([]DualOf[F], len(g.inputs))
+	device.LoadSlice(g.inputs, inputs)
 	memory := make(map[string]int)
-	space := 2 * size
 	for {
 		iterations++
 		if limit != 0 && iterations > limit {
@@ -109,46 +265,45 @@ func factorForward(size int, factor uint, limit int, log bool) (y, x uint64, fac
 
 		input := rand.Intn(len(inputs))
 		inputs[input].Der = 1
-		device.SetSlice("I", inputs)
-		location := device.String("I")
+		device.StoreSlice(g.inputs, inputs)
+		location := device.Bits(g.inputs)
 		inputs[input].Der = 0
 		device.Execute(false)
 
-		var cost Dual
-		target := factor
-		for i := 0; i < 2*size; i++ {
-			var a Dual
+		var cost DualOf[F]
+		target := g.value
+		for _, index := range g.target {
+			var a DualOf[F]
 			if target&1 == 1 {
 				a.Val = 1.0
 			}
-			b := device.Get(fmt.Sprintf("P%d", i))
+			b := device.Memory[index]
 			cost = Add(cost, Pow(Sub(a, b), 2))
 			target >>= 1
 		}
-		cost = Add(cost, hill(1, "Y"))
-		cost = Add(cost, hill(1, "X"))
-		cost = Add(cost, hill(0, "Y"))
-		cost = Add(cost, hill(0, "X"))
+		if g.cost != nil {
+			cost = g.cost(cost)
+		}
 
 		if log {
 			fmt.Printf("%d Val: %f, Der: %f\n", input, cost.Val, cost.Der)
-			fmt.Printf("P: %d, Y: %d, X: %d\n", device.Uint64("P"), device.Uint64("Y"), device.Uint64("X"))
+			g.print()
 		}
-		if math.IsNaN(float64(cost.Der)) {
+		nan := math.IsNaN(float64(cost.Der))
+		if nan && !g.unknown {
 			break
 		} else if cost.Val == 0 {
-			y = device.Uint64("Y")
-			x = device.Uint64("X")
-			factored = true
+			found = true
 			break
 		}
 
 		count := memory[location]
-		if count < space {
+		if count < g.space {
 			memory[location] = count + 1
 		}
 
-		if float64(count)/float64(space) > rand.Float64() {
+		// the derivative overflows in deep circuits, so NaN can be treated as unknown
+		if nan || float64(count)/float64(g.space) > rand.Float64() {
 			inputs[input].Val = 1 - inputs[input].Val
 		} else if cost.Der > 0 {
 			inputs[input].Val = 0
@@ -161,22 +316,98 @@ func factorForward(size int, factor uint, limit int, log bool) (y, x uint64, fac
 	if log {
 		fmt.Printf("iterations=%d\n", iterations)
 	}
-	return y, x, factored
+	return found
 }
 
-func factorForwardNeural(size int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
-	rand.Seed(1)
-	max := uint64(1)
-	for i := 0; i < size; i++ {
-		max *= 2
+func factorForward[F Float](xBits, yBits int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
+	circuit := newMultiplier(xBits, yBits, FullAdderA1, HalfAdderA1)
+	device := NewDevice[DualOf[F]](&circuit, DualLogic[F]{MappingOf: &HyperbolicParaboloid[F]{}})
+	defer traceSearch(&circuit, &device)()
+	one := DualOf[F]{Val: 1.0}
+	device.Schedule = newSchedule(&circuit)
+	yBus, xBus, pBus, iBus := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P"), NewBus(&circuit, "I")
+	hill := func(target int, bus Bus) DualOf[F] {
+		acc := one
+		for _, index := range bus {
+			value := device.Memory[index]
+			bit := target & 1
+			if bit == 1 {
+				acc = Mul(acc, value)
+			} else {
+				acc = Mul(acc, Sub(one, value))
+			}
+			target >>= 1
+		}
+		return acc
+	}
+
+	device.Store(yBus, uint64(rand.Intn(1<<uint(yBits))))
+	device.Store(xBus, uint64(rand.Intn(1<<uint(xBits))))
+	search := gradient[F]{
+		device: &device,
+		inputs: iBus,
+		target: pBus,
+		value:  uint64(factor),
+		space:  xBits + yBits,
+		cost: func(cost DualOf[F]) DualOf[F] {
+			cost = Add(cost, hill(1, yBus))
+			cost = Add(cost, hill(1, xBus))
+			cost = Add(cost, hill(0, yBus))
+			return Add(cost, hill(0, xBus))
+		},
+		print: func() {
+			fmt.Printf("P: %d, Y: %d, X: %d\n", device.Load(pBus), device.Load(yBus), device.Load(xBus))
+		},
+	}
+	if search.search(limit, log) {
+		return device.Load(yBus), device.Load(xBus), true
+	}
+	return 0, 0, false
+}
+
+func discreteLog[F Float](xBits int, power uint, limit int, log bool) (x uint64, found bool) {
+	circuit := ModularExponentiation(xBits, uint64(*base), uint64(*modulus), FullAdderA1, HalfAdderA1)
+	if *optimize {
+		err := circuit.Optimize(1024, DefaultPasses...)
+		if err != nil {
+			panic(err)
+		}
+	}
+	device := NewDevice[DualOf[F]](&circuit, DualLogic[F]{MappingOf: &HyperbolicParaboloid[F]{}})
+	defer traceSearch(&circuit, &device)()
+	device.Schedule = newSchedule(&circuit)
+	xBus, pBus, iBus := NewBus(&circuit, "X"), NewBus(&circuit, "P"), NewBus(&circuit, "I")
+
+	device.Store(xBus, uint64(rand.Intn(1<<uint(xBits))))
+	search := gradient[F]{
+		device:  &device,
+		inputs:  iBus,
+		target:  pBus,
+		value:   uint64(power),
+		space:   xBits,
+		unknown: true,
+		print: func() {
+			fmt.Printf("P: %d, X: %d\n", device.Load(pBus), device.Load(xBus))
+		},
+	}
+	if search.search(limit, log) {
+		return device.Load(xBus), true
 	}
+	return 0, false
+}
+
+func factorForwardNeural(xBits, yBits int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
+	rand.Seed(1)
 	iterations := 0
-	circuit := Multiplier(size, FullAdderA1, HalfAdderA1)
+	circuit := newMultiplier(xBits, yBits, FullAdderA1, HalfAdderA1)
 	device := circuit.NewDeviceDual(NewNeuralMapping())
-	hill := func(target int, prefix string) Dual {
+	defer traceSearch(&circuit, &device)()
+	device.Schedule = newSchedule(&circuit)
+	yBus, xBus, pBus, iBus := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P"), NewBus(&circuit, "I")
+	hill := func(target int, bus Bus) Dual {
 		acc := Dual{Val: 1.0}
-		for i := 0; i < size; i++ {
-			value := device.Get(fmt.Sprintf("%s%d", prefix, i))
+		for _, index := range bus {
+			value := device.Memory[index]
 			bit := target & 1
 			if bit == 1 {
 				acc = Mul(acc, value)
@@ -188,10 +419,10 @@ func factorForwardNeural(size int, factor uint, limit int, log bool) (y, x uint6
 		return acc
 	}
 
-	device.SetUint64("Y", uint64(rand.Intn(int(max))))
-	device.SetUint64("X", uint64(rand.Intn(int(max))))
-	inputs := device.AllocateSlice("I")
-	device.GetSlice("I", inputs)
+	device.Store(yBus, uint64(rand.Intn(1<<uint(yBits))))
+	device.Store(xBus, uint64(rand.Intn(1<<uint(xBits))))
+	inputs := make([]Dual, len(iBus))
+	device.LoadSlice(iBus, inputs)
 	gradients, deltas := make([]float32, len(inputs)), make([]float32, len(inputs))
 	alpha, eta := float32(.2), float32(.8)
 	for {
@@ -203,25 +434,25 @@ func factorForwardNeural(size int, factor uint, limit int, log bool) (y, x uint6
 		var networkCost float32
 		for i := range inputs {
 			inputs[i].Der = 1
-			device.SetSlice("I", inputs)
+			device.StoreSlice(iBus, inputs)
 			inputs[i].Der = 0
 			device.Execute(false)
 
 			var cost Dual
 			target := factor
-			for j := 0; j < 2*size; j++ {
+			for j := 0; j < xBits+yBits; j++ {
 				var a Dual
 				if target&1 == 1 {
 					a.Val = 1.0
 				}
-				b := device.Get(fmt.Sprintf("P%d", j))
+				b := device.Memory[pBus[j]]
 				cost = Add(cost, Pow(Sub(a, b), 2))
 				target >>= 1
 			}
-			cost = Add(cost, hill(1, "Y"))
-			cost = Add(cost, hill(1, "X"))
-			cost = Add(cost, hill(0, "Y"))
-			cost = Add(cost, hill(0, "X"))
+			cost = Add(cost, hill(1, yBus))
+			cost = Add(cost, hill(1, xBus))
+			cost = Add(cost, hill(0, yBus))
+			cost = Add(cost, hill(0, xBus))
 			networkCost = cost.Val
 			gradients[i] = cost.Der
 			device.Reset()
@@ -241,9 +472,9 @@ func factorForwardNeural(size int, factor uint, limit int, log bool) (y, x uint6
 			}
 		}
 
-		device.SetSlice("I", inputs)
+		device.StoreSlice(iBus, inputs)
 		device.Execute(false)
-		p, yy, xx := device.Uint64("P"), device.Uint64("Y"), device.Uint64("X")
+		p, yy, xx := device.Load(pBus), device.Load(yBus), device.Load(xBus)
 		if p == uint64(factor) {
 			break
 		}
@@ -259,20 +490,23 @@ func factorForwardNeural(size int, factor uint, limit int, log bool) (y, x uint6
 	return y, x, factored
 }
 
-func factorForwardProbabilistic(size int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
+func factorForwardProbabilistic[F Float](xBits, yBits int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
 	type Hill struct {
 		Y, X uint64
 	}
 
 	iterations := 0
-	circuit := Multiplier4()
-	device := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
+	circuit := newSearchMultiplier(xBits, yBits)
+	device := NewDevice[DualOf[F]](&circuit, DualLogic[F]{MappingOf: &HyperbolicParaboloid[F]{}})
+	defer traceSearch(&circuit, &device)()
+	one := DualOf[F]{Val: 1.0}
+	yBus, xBus, pBus, iBus := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P"), NewBus(&circuit, "I")
 	//root := uint64(math.Sqrt(float64(factor)))
-	device.SetUint64("Y", 15)
-	device.SetUint64("X", 15)
+	device.Store(yBus, 1<<uint(yBits)-1)
+	device.Store(xBus, 1<<uint(xBits)-1)
 	hills := []Hill{}
-	inputs := device.AllocateSlice("I")
-	device.GetSlice("I", inputs)
+	inputs := make([]DualOf[F], len(iBus))
+	device.LoadSlice(iBus, inputs)
 	lastX, lastY, stuck := uint64(0), uint64(0), 0
 	der := make([]float32, len(inputs))
 search:
@@ -284,41 +518,41 @@ search:
 
 		for input := range inputs {
 			inputs[input].Der = 1
-			device.SetSlice("I", inputs)
+			device.StoreSlice(iBus, inputs)
 			inputs[input].Der = 0
 			device.Execute(false)
 
-			var cost Dual
+			var cost DualOf[F]
 			target := factor
-			for i := 0; i < 8; i++ {
-				var a Dual
+			for i := 0; i < xBits+yBits; i++ {
+				var a DualOf[F]
 				if target&1 == 1 {
 					a.Val = 1.0
 				}
-				b := device.Get(fmt.Sprintf("P%d", i))
+				b := device.Memory[pBus[i]]
 				cost = Add(cost, Pow(Sub(a, b), 2))
 				target >>= 1
 			}
 
 			for _, hill := range hills {
-				acc := Dual{Val: 1.0}
-				for i := 0; i < 4; i++ {
-					value := device.Get(fmt.Sprintf("Y%d", i))
+				acc := one
+				for i := 0; i < yBits; i++ {
+					value := device.Memory[yBus[i]]
 					bit := hill.Y & 1
 					if bit == 1 {
 						acc = Mul(acc, value)
 					} else {
-						acc = Mul(acc, Sub(One, value))
+						acc = Mul(acc, Sub(one, value))
 					}
 					hill.Y >>= 1
 				}
-				for i := 0; i < 4; i++ {
-					value := device.Get(fmt.Sprintf("X%d", i))
+				for i := 0; i < xBits; i++ {
+					value := device.Memory[xBus[i]]
 					bit := hill.X & 1
 					if bit == 1 {
 						acc = Mul(acc, value)
 					} else {
-						acc = Mul(acc, Sub(One, value))
+						acc = Mul(acc, Sub(one, value))
 					}
 					hill.X >>= 1
 				}
@@ -327,14 +561,14 @@ search:
 
 			// Y != 1
 			hill := 1
-			acc := Dual{Val: 1.0}
-			for i := 0; i < 4; i++ {
-				value := device.Get(fmt.Sprintf("Y%d", i))
+			acc := one
+			for i := 0; i < yBits; i++ {
+				value := device.Memory[yBus[i]]
 				bit := hill & 1
 				if bit == 1 {
 					acc = Mul(acc, value)
 				} else {
-					acc = Mul(acc, Sub(One, value))
+					acc = Mul(acc, Sub(one, value))
 				}
 				hill >>= 1
 			}
@@ -342,14 +576,14 @@ search:
 
 			// X != 1
 			hill = 1
-			acc = Dual{Val: 1.0}
-			for i := 0; i < 4; i++ {
-				value := device.Get(fmt.Sprintf("X%d", i))
+			acc = one
+			for i := 0; i < xBits; i++ {
+				value := device.Memory[xBus[i]]
 				bit := hill & 1
 				if bit == 1 {
 					acc = Mul(acc, value)
 				} else {
-					acc = Mul(acc, Sub(One, value))
+					acc = Mul(acc, Sub(one, value))
 				}
 				hill >>= 1
 			}
@@ -357,14 +591,14 @@ search:
 
 			// Y != 0
 			hill = 0
-			acc = Dual{Val: 1.0}
-			for i := 0; i < 4; i++ {
-				value := device.Get(fmt.Sprintf("Y%d", i))
+			acc = one
+			for i := 0; i < yBits; i++ {
+				value := device.Memory[yBus[i]]
 				bit := hill & 1
 				if bit == 1 {
 					acc = Mul(acc, value)
 				} else {
-					acc = Mul(acc, Sub(One, value))
+					acc = Mul(acc, Sub(one, value))
 				}
 				hill >>= 1
 			}
@@ -372,14 +606,14 @@ search:
 
 			// X != 0
 			hill = 0
-			acc = Dual{Val: 1.0}
-			for i := 0; i < 4; i++ {
-				value := device.Get(fmt.Sprintf("X%d", i))
+			acc = one
+			for i := 0; i < xBits; i++ {
+				value := device.Memory[xBus[i]]
 				bit := hill & 1
 				if bit == 1 {
 					acc = Mul(acc, value)
 				} else {
-					acc = Mul(acc, Sub(One, value))
+					acc = Mul(acc, Sub(one, value))
 				}
 				hill >>= 1
 			}
@@ -387,13 +621,13 @@ search:
 
 			if log {
 				fmt.Printf("%d Val: %f, Der: %f\n", input, cost.Val, cost.Der)
-				fmt.Printf("P: %d, Y: %d, X: %d\n", device.Uint64("P"), device.Uint64("Y"), device.Uint64("X"))
+				fmt.Printf("P: %d, Y: %d, X: %d\n", device.Load(pBus), device.Load(yBus), device.Load(xBus))
 			}
 			if math.IsNaN(float64(cost.Der)) {
 				break search
 			} else if cost.Val == 0 {
-				y = device.Uint64("Y")
-				x = device.Uint64("X")
+				y = device.Load(yBus)
+				x = device.Load(xBus)
 				factored = true
 				break search
 			}
@@ -420,9 +654,9 @@ search:
 		//fmt.Printf("\n")
 		inputs[mutate].Val = 1 - inputs[mutate].Val
 
-		device.SetSlice("I", inputs)
-		yy := device.Uint64("Y")
-		xx := device.Uint64("X")
+		device.StoreSlice(iBus, inputs)
+		yy := device.Load(yBus)
+		xx := device.Load(xBus)
 		if yy == lastY && xx == lastX {
 			stuck++
 		} else {
@@ -441,11 +675,19 @@ search:
 	return y, x, factored
 }
 
-func factorReverse(size int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
+func factorReverse[F Float](xBits, yBits int, factor uint, limit int, log bool) (y, x uint64, factored bool) {
 	iterations := 0
-	circuit := Multiplier4()
-	device := circuit.NewDeviceDual(&HyperbolicParaboloidMapping{})
-	values := device.AllocateSlice("G")
+	circuit := newSearchMultiplier(xBits, yBits)
+	device := NewDevice[DualOf[F]](&circuit, DualLogic[F]{MappingOf: &HyperbolicParaboloid[F]{}})
+	defer traceSearch(&circuit, &device)()
+	yBus, xBus, pBus, gBus := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P"), NewBus(&circuit, "G")
+	var ancillas []Bus
+	for _, bus := range []string{"A", "Z", "O"} {
+		if _, ok := circuit.Buses[bus]; ok {
+			ancillas = append(ancillas, NewBus(&circuit, bus))
+		}
+	}
+	values := make([]DualOf[F], len(gBus))
 	for i := range values {
 		if rand.Intn(2) == 0 {
 			values[i].Val = 1.0
@@ -460,28 +702,25 @@ search:
 		for name := range values {
 			//name := rand.Intn(len(values))
 			values[name].Der = 1.0
-			device.SetSlice("G", values)
-			device.SetUint64("P", uint64(factor))
+			device.StoreSlice(gBus, values)
+			device.Store(pBus, uint64(factor))
 			device.Execute(true)
-			var cost Dual
-			for i := 0; i < 16; i++ {
-				a := device.Get(fmt.Sprintf("A%d", i))
-				cost = Add(cost, Pow(a, 2))
-			}
-			for i := 0; i < 12; i++ {
-				a := device.Get(fmt.Sprintf("Z%d", i))
-				cost = Add(cost, Pow(a, 2))
+			var cost DualOf[F]
+			for _, bus := range ancillas {
+				for _, index := range bus {
+					cost = Add(cost, Pow(device.Memory[index], 2))
+				}
 			}
 
 			if log {
 				fmt.Printf("%d Val: %f, Der: %f\n", name, cost.Val, cost.Der)
-				fmt.Printf("Y: %d, X: %d\n", device.Uint64("Y"), device.Uint64("X"))
+				fmt.Printf("Y: %d, X: %d\n", device.Load(yBus), device.Load(xBus))
 			}
 			if math.IsNaN(float64(cost.Der)) {
 				break search
 			} else if cost.Val == 0 {
-				y = device.Uint64("Y")
-				x = device.Uint64("X")
+				y = device.Load(yBus)
+				x = device.Load(xBus)
 				factored = true
 				break search
 			}
@@ -507,30 +746,34 @@ func main() {
 	flag.Parse()
 
 	if *test {
-		const max = (1 << 28)
-		for i := 0; i < max; i++ {
-			circuit := Multiplier4()
-			device := circuit.NewDeviceBool()
-			device.SetUint64("P", uint64(81))
-			device.SetUint64("G", uint64(i))
+		xBits, yBits := widths(4, 4)
+		product := uint64(81)
+		if isSet("factor") {
+			product = uint64(*factor)
+		}
+		circuit := newMultiplier(xBits, yBits, FullAdderA1, HalfAdderA1)
+		garbage := circuit.Buses["G"]
+		if garbage > 36 {
+			panic(fmt.Errorf("%d garbage bits are too many to scan, lower -xbits and -ybits", garbage))
+		}
+		max := uint64(1) << garbage
+		device := circuit.NewDeviceParallel()
+		yBus, xBus, pBus := NewBus(&circuit, "Y"), NewBus(&circuit, "X"), NewBus(&circuit, "P")
+		for i := uint64(0); i < max; i += Lanes {
+			device.Store(pBus, product)
+			device.SetCounter("G", i)
 			device.Execute(true)
-			countA := 0
-			for j := 0; j < 16; j++ {
-				name := fmt.Sprintf("A%d", j)
-				if device.Get(name) {
-					countA++
-				}
+			valid := ^uint64(0)
+			if max-i < Lanes {
+				valid = 1<<(max-i) - 1
 			}
-			countB := 0
-			for j := 0; j < 12; j++ {
-				name := fmt.Sprintf("Z%d", j)
-				if device.Get(name) {
-					countB++
+			zero := ^ancilla(&device) & valid
+			for lane := 0; lane < Lanes; lane++ {
+				if zero>>uint(lane)&1 == 1 {
+					fmt.Println(device.LoadLane(xBus, lane), device.LoadLane(yBus, lane), device.LoadLane(pBus, lane))
 				}
 			}
-			if countA == 0 && countB == 0 {
-				fmt.Println(device.Uint64("X"), device.Uint64("Y"), device.Uint64("P"))
-			} else {
+			if i%(1<<20) == 0 {
 				fmt.Println(float64(i) / float64(max))
 			}
 			device.Reset()
@@ -538,6 +781,31 @@ func main() {
 		return
 	}
 
+	if *replay != "" {
+		file, err := os.Open(*replay)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+		t, err := ReadTrace(file)
+		if err != nil {
+			panic(err)
+		}
+		var names []string
+		if *filter != "" {
+			names = strings.Split(*filter, ",")
+		}
+		selected, err := t.Select(names...)
+		if err != nil {
+			panic(err)
+		}
+		err = t.Replay(os.Stdin, os.Stdout, selected)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	if *help {
 		flag.PrintDefaults()
 		return
@@ -548,35 +816,115 @@ func main() {
 		return
 	}
 
-	if *factor > 15*15 {
-		panic(fmt.Errorf("factor must be [0,%d]", 15*15))
+	if *report {
+		for _, r := range Reductions {
+			for _, adder := range Adders {
+				circuit := newReducedMultiplier(*xbits, *ybits, r.Reduction, adder.Full, adder.Half)
+				analysis := circuit.Analyze()
+				fmt.Printf("%s %s\n", r.Name, adder.Name)
+				analysis.Print()
+			}
+		}
+		return
+	}
+
+	if *export != "" || *dot != "" || *svg != "" {
+		circuit := newMultiplier(*xbits, *ybits, FullAdderA1, HalfAdderA1)
+		circuit.ComputeRanks()
+		write := func(name string, writer func(out io.Writer) error) {
+			if name == "" {
+				return
+			}
+			file, err := os.Create(name)
+			if err != nil {
+				panic(err)
+			}
+			defer file.Close()
+			err = writer(file)
+			if err != nil {
+				panic(err)
+			}
+		}
+		write(*export, circuit.WriteReal)
+		write(*dot, circuit.WriteDot)
+		write(*svg, circuit.WriteSVG)
+		return
+	}
+
+	if *precision != 32 && *precision != 64 {
+		panic(fmt.Errorf("invalid precision %d; valid precisions: [32, 64]", *precision))
 	}
+	double := *precision == 64
 
-	var f func(size int, factor uint, limit int, log bool) (y, x uint64, factored bool)
+	if *mode == "log" {
+		logarithm := discreteLog[float32]
+		if double {
+			logarithm = discreteLog[float64]
+		}
+		if *all {
+			found, total := 0, 0
+			for power := uint(1); power < *modulus; power++ {
+				x, ok := logarithm(*xbits, power, 2000, false)
+				if ok {
+					fmt.Printf("%d^%d = %d mod %d\n", *base, x, power, *modulus)
+					found++
+				} else {
+					fmt.Printf("%d not found\n", power)
+				}
+				total++
+			}
+			fmt.Printf("found=%d/%d %f\n", found, total, float64(found)/float64(total))
+			return
+		}
+		if *power >= *modulus {
+			panic(fmt.Errorf("power must be [0,%d]", *modulus-1))
+		}
+		logarithm(*xbits, *power, 0, true)
+		return
+	}
+
+	var f func(xBits, yBits int, factor uint, limit int, log bool) (y, x uint64, factored bool)
 	var iterations int
+	xBits, yBits := *xbits, *ybits
 	switch *mode {
 	case "forward":
-		f, iterations = factorForward, 2000
+		f, iterations = factorForward[float32], 2000
+		if double {
+			f = factorForward[float64]
+		}
 	case "neural":
+		if double {
+			panic("the neural mapping only supports a precision of 32")
+		}
 		f, iterations = factorForwardNeural, 2000
 	case "reverse":
-		f, iterations = factorReverse, 100
+		xBits, yBits = widths(4, 4)
+		f, iterations = factorReverse[float32], budget(100, xBits+yBits)
+		if double {
+			f = factorReverse[float64]
+		}
 	case "prob":
-		f, iterations = factorForwardProbabilistic, 1000
+		xBits, yBits = widths(4, 4)
+		f, iterations = factorForwardProbabilistic[float32], budget(1000, xBits+yBits)
+		if double {
+			f = factorForwardProbabilistic[float64]
+		}
 	default:
-		panic("invalid mode; valid modes: [forward, reverse, prob]")
+		panic("invalid mode; valid modes: [forward, neural, reverse, prob, log]")
 	}
 
-	size := 5
-	max := uint64(1)
-	for i := 0; i < size; i++ {
-		max *= 2
+	space := (uint64(1)<<uint(xBits) - 1) * (uint64(1)<<uint(yBits) - 1)
+	if !*all && uint64(*factor) > space {
+		panic(fmt.Errorf("factor must be [0,%d]", space))
 	}
-	space := (max - 1) * (max - 1)
 
 	if *all {
+		limit := uint(225)
+		if isSet("xbits") || isSet("ybits") {
+			limit = uint(space)
+		}
 		primes := []uint{2, 3}
-		for i := uint(4); i <= uint(space); i++ {
+		for i := uint(4); i <= limit; i++ {
 			isPrime := true
 			for _, prime := range primes {
 				if i%prime == 0 {
@@ -594,7 +942,7 @@ func main() {
 		}
 
 		factored, total := 0, 0
-		for i := uint(2); i <= uint(space); i++ {
+		for i := uint(2); i <= limit; i++ {
 			factors := 0
 			for _, prime := range primes {
 				if i%prime == 0 {
@@ -605,9 +953,9 @@ func main() {
 			if primeMap[i] {
 				fmt.Printf(" is prime\n")
 			} else {
-				y, x, ok := f(size, uint(i), iterations, false)
+				y, x, ok := f(xBits, yBits, uint(i), iterations, false)
 				/*for j := 0; j < 2 && !ok; j++ {
-					y, x, ok = f(size, uint(i), iterations, false)
+					y, x, ok = f(xBits, yBits, uint(i), iterations, false)
 				}*/
 				if ok {
 					fmt.Printf(" factored %d %d\n", y, x)
@@ -618,13 +966,10 @@ func main() {
 					fmt.Printf("\n")
 				}
 			}
-			if i == 225 {
-				break
-			}
 		}
 		fmt.Printf("factored=%d/%d %f\n", factored, total, float64(factored)/float64(total))
 		return
 	}
 
-	f(size, *factor, 0, true)
+	f(xBits, yBits, *factor, 0, true)
 }
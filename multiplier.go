@@ -9,6 +9,19 @@ import "fmt"
 type FullAdder func(circuit *Circuit, a, b, c, d string) (sum, carry string)
 type HalfAdder func(circuit *Circuit, b, c, d string) (sum, carry string)
 
+type Adder struct {
+	Name string
+	Full FullAdder
+	Half HalfAdder
+}
+
+var Adders = []Adder{
+	{"A1", FullAdderA1, HalfAdderA1},
+	{"A2", FullAdderA2, HalfAdderA2},
+	{"A3", FullAdderA3, HalfAdderA3},
+	{"Peres", FullAdderPeres, HalfAdderPeres},
+}
+
 func FullAdderA1(circuit *Circuit, a, b, c, d string) (sum, carry string) {
 	circuit.AddGateCCNot(a, b, d)
 	circuit.AddGateCNot(b, a)
@@ -57,14 +70,35 @@ func HalfAdderA3(circuit *Circuit, b, c, d string) (sum, carry string) {
 	return c, d
 }
 
-func Multiplier(size int, full FullAdder, half HalfAdder) Circuit {
+func FullAdderPeres(circuit *Circuit, a, b, c, d string) (sum, carry string) {
+	circuit.AddGatePeres(a, b, d)
+	circuit.AddGatePeres(b, c, d)
+	circuit.AddAlias(a, "G")
+	circuit.AddAlias(b, "G")
+	return c, d
+}
+func HalfAdderPeres(circuit *Circuit, b, c, d string) (sum, carry string) {
+	circuit.AddGatePeres(b, c, d)
+	circuit.AddAlias(b, "G")
+	return c, d
+}
+
+// Multiplier computes P = Y * X for an xBits wide X and a yBits wide Y with
+// the partial products reduced sequentially column by column
+func Multiplier(xBits, yBits int, full FullAdder, half HalfAdder) Circuit {
+	return ReducedMultiplier(xBits, yBits, SequentialReduction, full, half)
+}
+
+// ReducedMultiplier computes P = Y * X with the partial products reduced by
+// the given strategy
+func ReducedMultiplier(xBits, yBits int, reduction Reduction, full FullAdder, half HalfAdder) Circuit {
 	circuit := NewCircuit()
 
 	circuit.AddBus("I", 0, true)
-	circuit.AddBus("Y", size, false)
-	circuit.AddBus("X", size, false)
-	circuit.AddBus("A", size*size, false)
-	circuit.AddBus("P", 2*size, true)
+	circuit.AddBus("Y", yBits, false)
+	circuit.AddBus("X", xBits, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("P", xBits+yBits, true)
 	circuit.AddBus("Z", 0, false)
 	circuit.AddBus("G", 0, true)
 
@@ -73,37 +107,87 @@ func Multiplier(size int, full FullAdder, half HalfAdder) Circuit {
 	circuit.AddAlias("Y", "G")
 	circuit.AddAlias("X", "G")
 
-	a, sums := 0, make([][]string, 2*size)
-	for x := 0; x < size; x++ {
-		for y := 0; y < size; y++ {
-			product, column := fmt.Sprintf("A%d", a), x+y
-			circuit.AddGateCCNot(fmt.Sprintf("Y%d", y), fmt.Sprintf("X%d", x), product)
-			sums[column] = append(sums[column], product)
-			a++
+	y, err := circuit.busWires("Y")
+	if err != nil {
+		panic(err)
+	}
+	x, err := circuit.busWires("X")
+	if err != nil {
+		panic(err)
+	}
+	for i, output := range circuit.addProduct(y, x, reduction, full, half) {
+		circuit.AddAlias(output, fmt.Sprintf("P%d", i))
+	}
+
+	return circuit
+}
+
+// addProduct multiplies the wires y and x into new A wires which are reduced
+// to one wire per bit of the product by the given strategy
+func (c *Circuit) addProduct(y, x []string, reduction Reduction, full FullAdder, half HalfAdder) []string {
+	sums := make([][]string, len(y)+len(x))
+	for i := range x {
+		for j := range y {
+			product := c.AddWire("A", false)
+			c.AddGateCCNot(y[j], x[i], product)
+			sums[i+j] = append(sums[i+j], product)
+		}
+	}
+	return c.reduce(sums, reduction, full, half)
+}
+
+// addSquare squares the wires x into new A wires with the partial products
+// x_i * x_j for i < j appearing once in the column i + j + 1 and x_i * x_i
+// being x_i
+func (c *Circuit) addSquare(x []string, reduction Reduction, full FullAdder, half HalfAdder) []string {
+	sums := make([][]string, 2*len(x))
+	for i := range x {
+		product := c.AddWire("A", false)
+		c.AddGateCNot(x[i], product)
+		sums[2*i] = append(sums[2*i], product)
+		for j := i + 1; j < len(x); j++ {
+			product := c.AddWire("A", false)
+			c.AddGateCCNot(x[i], x[j], product)
+			sums[i+j+1] = append(sums[i+j+1], product)
 		}
 	}
+	return c.reduce(sums, reduction, full, half)
+}
 
-	for i := range sums {
-		product := fmt.Sprintf("P%d", i)
-		for {
-			if length := len(sums[i]); length > 2 {
-				z := circuit.AddWire("Z", false)
-				sum, carry := full(&circuit, sums[i][0], sums[i][1], sums[i][2], z)
-				sums[i][2] = sum
-				sums[i] = sums[i][2:]
-				sums[i+1] = append(sums[i+1], carry)
-			} else if length == 2 {
-				z := circuit.AddWire("Z", false)
-				sum, carry := half(&circuit, sums[i][0], sums[i][1], z)
-				sums[i][1] = sum
-				sums[i] = sums[i][1:]
-				sums[i+1] = append(sums[i+1], carry)
-			} else {
-				circuit.AddAlias(sums[i][0], product)
-				break
-			}
+// reduce reduces the columns to one wire per column, empty columns are new
+// Z wires
+func (c *Circuit) reduce(sums [][]string, reduction Reduction, full FullAdder, half HalfAdder) []string {
+	outputs := reduction(c, sums, full, half)[:len(sums)]
+	for i, output := range outputs {
+		if output == "" {
+			outputs[i] = c.AddWire("Z", false)
 		}
 	}
+	return outputs
+}
+
+// Square computes P = X * X with about half of the partial products of
+// Multiplier
+func Square(size int, full FullAdder, half HalfAdder) Circuit {
+	circuit := NewCircuit()
+
+	circuit.AddBus("I", 0, true)
+	circuit.AddBus("X", size, false)
+	circuit.AddBus("A", 0, false)
+	circuit.AddBus("P", 2*size, true)
+	circuit.AddBus("Z", 0, false)
+	circuit.AddBus("G", 0, true)
+
+	circuit.AddAlias("X", "I")
+	circuit.AddAlias("X", "G")
+
+	x, err := circuit.busWires("X")
+	if err != nil {
+		panic(err)
+	}
+	for i, output := range circuit.addSquare(x, SequentialReduction, full, half) {
+		circuit.AddAlias(output, fmt.Sprintf("P%d", i))
+	}
 
 	return circuit
 }
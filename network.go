@@ -18,22 +18,32 @@ type Network struct {
 	Sizes  []int
 	Layers [][]Weight
 	Biases [][]Weight
+	// Rand orders the training data, the global source is used if it is nil
+	Rand *rand.Rand
 }
 
-func random32(a, b float32) float32 {
-	return (b-a)*rand.Float32() + a
+func random32(rnd *rand.Rand, a, b float32) float32 {
+	if rnd == nil {
+		return (b-a)*rand.Float32() + a
+	}
+	return (b-a)*rnd.Float32() + a
 }
 
 func NewNetwork(sizes ...int) Network {
+	return NewNetworkRand(nil, sizes...)
+}
+
+// NewNetworkRand creates a network whose weights and training order are drawn from rnd
+func NewNetworkRand(rnd *rand.Rand, sizes ...int) Network {
 	last, layers, biases := sizes[0], make([][]Weight, len(sizes)-1), make([][]Weight, len(sizes)-1)
 	for i, size := range sizes[1:] {
 		layers[i] = make([]Weight, last*size)
 		for j := range layers[i] {
-			layers[i][j].Weight.Val = random32(-1, 1) / float32(math.Sqrt(float64(last)))
+			layers[i][j].Weight.Val = random32(rnd, -1, 1) / float32(math.Sqrt(float64(last)))
 		}
 		biases[i] = make([]Weight, size)
 		for j := range biases[i] {
-			biases[i][j].Weight.Val = random32(-1, 1) / float32(math.Sqrt(float64(last)))
+			biases[i][j].Weight.Val = random32(rnd, -1, 1) / float32(math.Sqrt(float64(last)))
 		}
 		last = size
 	}
@@ -41,6 +51,7 @@ func NewNetwork(sizes ...int) Network {
 		Sizes:  sizes,
 		Layers: layers,
 		Biases: biases,
+		Rand:   rnd,
 	}
 }
 
@@ -79,13 +90,20 @@ type TrainingData struct {
 	Inputs, Outputs []float32
 }
 
+func (n *Network) intn(size int) int {
+	if n.Rand == nil {
+		return rand.Intn(size)
+	}
+	return n.Rand.Intn(size)
+}
+
 func (n *Network) Train(data []TrainingData, target float64, alpha, eta float32) int {
 	size := len(data)
 	iterations, state, randomized := 0, n.NewNetState(), make([]TrainingData, size)
 	copy(randomized, data)
 	for {
 		for i, sample := range randomized {
-			j := i + rand.Intn(size-i)
+			j := i + n.intn(size-i)
 			randomized[i], randomized[j] = randomized[j], sample
 		}
 
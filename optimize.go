@@ -0,0 +1,207 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+type Pass struct {
+	Name string
+	Run  func(gates []Gate) []Gate
+}
+
+var DefaultPasses = []Pass{
+	{"cancel", CancelPass},
+	{"commute", CommutePass},
+	{"template", TemplatePass},
+}
+
+func (g *Gate) negative(i int) bool {
+	return g.Negative != nil && g.Negative[i]
+}
+
+func (g *Gate) Equal(h *Gate) bool {
+	if g.Type != h.Type || len(g.Taps) != len(h.Taps) {
+		return false
+	}
+	if g.Type == GateTypeFredkin && g.Taps[0] == h.Taps[0] &&
+		g.Taps[1] == h.Taps[2] && g.Taps[2] == h.Taps[1] {
+		return true
+	}
+	for i, tap := range g.Taps {
+		if tap != h.Taps[i] {
+			return false
+		}
+	}
+	for i := 0; i < len(g.Taps)-1; i++ {
+		if g.negative(i) != h.negative(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Gate) SelfInverse() bool {
+	return g.Type != GateTypePeres
+}
+
+// Commutes is true if neither gate modifies a wire used by the other
+func (g *Gate) Commutes(h *Gate) bool {
+	uses := func(a, b *Gate) bool {
+		for _, target := range a.Targets() {
+			for _, tap := range b.Taps {
+				if target == tap {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return !uses(g, h) && !uses(h, g)
+}
+
+func CancelPass(gates []Gate) []Gate {
+	optimized := make([]Gate, 0, len(gates))
+	for i := range gates {
+		if last := len(optimized) - 1; last >= 0 &&
+			gates[i].SelfInverse() && optimized[last].Equal(&gates[i]) {
+			optimized = optimized[:last]
+			continue
+		}
+		optimized = append(optimized, gates[i])
+	}
+	return optimized
+}
+
+func CommutePass(gates []Gate) []Gate {
+	optimized := make([]Gate, 0, len(gates))
+next:
+	for i := range gates {
+		gate := &gates[i]
+		if gate.SelfInverse() {
+			for j := len(optimized) - 1; j >= 0; j-- {
+				if optimized[j].Equal(gate) {
+					optimized = append(optimized[:j], optimized[j+1:]...)
+					continue next
+				}
+				if !optimized[j].Commutes(gate) {
+					break
+				}
+			}
+		}
+		optimized = append(optimized, *gate)
+	}
+	return optimized
+}
+
+// TemplatePass replaces the gate sequences
+//
+//	CCNot(a, b, c) CNot(a, b) with Peres(a, b, c)
+//	Not(a) G Not(a) with G controlled on a being zero
+func TemplatePass(gates []Gate) []Gate {
+	optimized := make([]Gate, 0, len(gates))
+	for i := 0; i < len(gates); i++ {
+		gate := gates[i]
+		if gate.Type == GateTypeCCNot && i+1 < len(gates) && gates[i+1].Type == GateTypeCNot {
+			a, b, c := gate.Taps[0], gate.Taps[1], gate.Taps[2]
+			control, target := gates[i+1].Taps[0], gates[i+1].Taps[1]
+			if (control == a && target == b) || (control == b && target == a) {
+				optimized = append(optimized, Gate{
+					Type: GateTypePeres,
+					Taps: []uint32{control, target, c},
+				})
+				i++
+				continue
+			}
+		}
+		if gate.Type == GateTypeNot && i+2 < len(gates) &&
+			gates[i+2].Type == GateTypeNot && gates[i+2].Taps[0] == gate.Taps[0] {
+			g := gates[i+1]
+			switch g.Type {
+			case GateTypeCNot, GateTypeCCNot, GateTypeMCNot:
+				controls, found := len(g.Taps)-1, -1
+				for j, tap := range g.Taps[:controls] {
+					if tap == gate.Taps[0] {
+						found = j
+					}
+				}
+				if found >= 0 {
+					flipped := Gate{
+						Type:     GateTypeMCNot,
+						Taps:     append([]uint32{}, g.Taps...),
+						Negative: make([]bool, controls),
+					}
+					for j := range flipped.Negative {
+						flipped.Negative[j] = g.negative(j) != (j == found)
+					}
+					optimized = append(optimized, flipped.Normalize())
+					i += 2
+					continue
+				}
+			}
+		}
+		optimized = append(optimized, gate)
+	}
+	return optimized
+}
+
+// SameFunction checks with a DeviceBool that the gates compute the same
+// function as the circuit over every wire, using random states when there
+// are more than ExhaustiveBits wires
+func (c *Circuit) SameFunction(gates []Gate, samples int) bool {
+	other := *c
+	other.Gates = gates
+	a, b := c.NewDeviceBool(), other.NewDeviceBool()
+	width := len(a.Memory)
+	test := func(state func(i int) bool) bool {
+		for i := range a.Memory {
+			a.Memory[i] = state(i)
+			b.Memory[i] = a.Memory[i]
+		}
+		a.Execute(false)
+		b.Execute(false)
+		for i, value := range a.Memory {
+			if b.Memory[i] != value {
+				return false
+			}
+		}
+		return true
+	}
+	if width <= ExhaustiveBits {
+		for vector := uint64(0); vector < 1<<uint(width); vector++ {
+			if !test(func(i int) bool { return vector&(1<<uint(i)) != 0 }) {
+				return false
+			}
+		}
+		return true
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < samples; i++ {
+		if !test(func(i int) bool { return rnd.Intn(2) == 1 }) {
+			return false
+		}
+	}
+	return true
+}
+
+// Optimize runs the passes until the gate count stops decreasing; when
+// samples is not zero each pass is verified with SameFunction
+func (c *Circuit) Optimize(samples int, passes ...Pass) error {
+	for {
+		count := len(c.Gates)
+		for _, pass := range passes {
+			gates := pass.Run(c.Gates)
+			if samples > 0 && !c.SameFunction(gates, samples) {
+				return fmt.Errorf("pass %s changed the function of the circuit", pass.Name)
+			}
+			c.Gates = gates
+		}
+		if len(c.Gates) >= count {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Reduction compresses columns of partial product wires into one wire per
+// column with full and half adders, an empty column results in ""
+type Reduction func(circuit *Circuit, columns [][]string, full FullAdder, half HalfAdder) []string
+
+var Reductions = []struct {
+	Name      string
+	Reduction Reduction
+}{
+	{"sequential", SequentialReduction},
+	{"wallace", WallaceReduction},
+	{"dadda", DaddaReduction},
+}
+
+// carry appends a carry wire to column i, adding the column if needed
+func carry(columns [][]string, i int, wire string) [][]string {
+	for len(columns) <= i {
+		columns = append(columns, nil)
+	}
+	columns[i] = append(columns[i], wire)
+	return columns
+}
+
+// SequentialReduction reduces each column in turn, carrying into the next
+// column, so the depth grows linearly with the size of the multiplier
+func SequentialReduction(circuit *Circuit, columns [][]string, full FullAdder, half HalfAdder) []string {
+	outputs := []string{}
+	for i := 0; i < len(columns); i++ {
+		for {
+			if length := len(columns[i]); length > 2 {
+				z := circuit.AddWire("Z", false)
+				sum, c := full(circuit, columns[i][0], columns[i][1], columns[i][2], z)
+				columns[i][2] = sum
+				columns[i] = columns[i][2:]
+				columns = carry(columns, i+1, c)
+			} else if length == 2 {
+				z := circuit.AddWire("Z", false)
+				sum, c := half(circuit, columns[i][0], columns[i][1], z)
+				columns[i][1] = sum
+				columns[i] = columns[i][1:]
+				columns = carry(columns, i+1, c)
+			} else {
+				output := ""
+				if length == 1 {
+					output = columns[i][0]
+				}
+				outputs = append(outputs, output)
+				break
+			}
+		}
+	}
+	return outputs
+}
+
+// WallaceReduction reduces every column at once in stages with as many
+// adders as possible until no column has more than two wires, the last two
+// rows are then added with SequentialReduction
+func WallaceReduction(circuit *Circuit, columns [][]string, full FullAdder, half HalfAdder) []string {
+	for {
+		height := 0
+		for _, column := range columns {
+			if len(column) > height {
+				height = len(column)
+			}
+		}
+		if height <= 2 {
+			break
+		}
+		next := make([][]string, len(columns))
+		for i, column := range columns {
+			if len(column) <= 2 {
+				next[i] = append(next[i], column...)
+				continue
+			}
+			for ; len(column) >= 3; column = column[3:] {
+				z := circuit.AddWire("Z", false)
+				sum, c := full(circuit, column[0], column[1], column[2], z)
+				next[i] = append(next[i], sum)
+				next = carry(next, i+1, c)
+			}
+			if len(column) == 2 {
+				z := circuit.AddWire("Z", false)
+				sum, c := half(circuit, column[0], column[1], z)
+				next[i] = append(next[i], sum)
+				next = carry(next, i+1, c)
+			} else {
+				next[i] = append(next[i], column...)
+			}
+		}
+		columns = next
+	}
+	return SequentialReduction(circuit, columns, full, half)
+}
+
+// DaddaReduction reduces the columns in stages to the heights 2, 3, 4, 6,
+// 9, ... using as few adders as possible in each stage, the last two rows
+// are then added with SequentialReduction
+func DaddaReduction(circuit *Circuit, columns [][]string, full FullAdder, half HalfAdder) []string {
+	height := 0
+	for _, column := range columns {
+		if len(column) > height {
+			height = len(column)
+		}
+	}
+	heights := []int{2}
+	for next := 3; next < height; next = next * 3 / 2 {
+		heights = append(heights, next)
+	}
+	for stage := len(heights) - 1; stage >= 0; stage-- {
+		target := heights[stage]
+		for i := 0; i < len(columns); i++ {
+			for len(columns[i]) > target {
+				column, z := columns[i], circuit.AddWire("Z", false)
+				if len(column) == target+1 {
+					sum, c := half(circuit, column[0], column[1], z)
+					columns[i] = append(column[2:], sum)
+					columns = carry(columns, i+1, c)
+				} else {
+					sum, c := full(circuit, column[0], column[1], column[2], z)
+					columns[i] = append(column[3:], sum)
+					columns = carry(columns, i+1, c)
+				}
+			}
+		}
+	}
+	return SequentialReduction(circuit, columns, full, half)
+}
+
+// RandomReduction returns a reduction which repeatedly picks a random column
+// with more than one wire and feeds random wires of it to an adder chosen at
+// random from adders
+func RandomReduction(rnd *rand.Rand, adders []Adder) Reduction {
+	return func(circuit *Circuit, columns [][]string, full FullAdder, half HalfAdder) []string {
+		for {
+			candidates := []int{}
+			for i, column := range columns {
+				if len(column) > 1 {
+					candidates = append(candidates, i)
+				}
+			}
+			if len(candidates) == 0 {
+				break
+			}
+			i := candidates[rnd.Intn(len(candidates))]
+			column := columns[i]
+			rnd.Shuffle(len(column), func(a, b int) {
+				column[a], column[b] = column[b], column[a]
+			})
+			adder := adders[rnd.Intn(len(adders))]
+			z := circuit.AddWire("Z", false)
+			if len(column) > 2 {
+				sum, c := adder.Full(circuit, column[0], column[1], column[2], z)
+				columns[i] = append(column[3:], sum)
+				columns = carry(columns, i+1, c)
+			} else {
+				sum, c := adder.Half(circuit, column[0], column[1], z)
+				columns[i] = append(column[2:], sum)
+				columns = carry(columns, i+1, c)
+			}
+		}
+		outputs := make([]string, len(columns))
+		for i, column := range columns {
+			if len(column) == 1 {
+				outputs[i] = column[0]
+			}
+		}
+		return outputs
+	}
+}
+
+// RandomMultiplier computes P = Y * X with a RandomReduction seeded by seed
+// using the A1, A2 and A3 adders. The circuit is checked against Multiplier
+// with Equivalent.
+func RandomMultiplier(xBits, yBits int, seed int64, samples int) (Circuit, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	circuit := ReducedMultiplier(xBits, yBits, RandomReduction(rnd, Adders[:3]), nil, nil)
+	reference := Multiplier(xBits, yBits, FullAdderA1, HalfAdderA1)
+	ports := Ports{
+		Inputs:  map[string]string{"Y": "Y", "X": "X"},
+		Outputs: map[string]string{"P": "P"},
+	}
+	counterexample, err := Equivalent(&circuit, &reference, ports, samples)
+	if err != nil {
+		return circuit, err
+	}
+	if counterexample != nil {
+		return circuit, fmt.Errorf("random multiplier %d is incorrect: %v", seed, counterexample)
+	}
+	return circuit, nil
+}
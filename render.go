@@ -0,0 +1,176 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// aliasesByWire returns the sorted aliases of each wire
+func (c *Circuit) aliasesByWire() map[string][]string {
+	aliases := make(map[string][]string)
+	for alias, name := range c.Aliases {
+		aliases[name] = append(aliases[name], alias)
+	}
+	for _, list := range aliases {
+		sort.Strings(list)
+	}
+	return aliases
+}
+
+func isGarbage(aliases []string) bool {
+	for _, alias := range aliases {
+		if prefix, _, ok := splitName(alias); ok && prefix == "G" {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteDot writes the wire/gate dependency graph in the graphviz DOT
+// language, wires are coloured from blue to red by Rank
+func (c *Circuit) WriteDot(out io.Writer) error {
+	wires, aliases := c.WiresByIndex(), c.aliasesByWire()
+	min, max := 0.0, 0.0
+	for i, wire := range wires {
+		if i == 0 || wire.Rank < min {
+			min = wire.Rank
+		}
+		if i == 0 || wire.Rank > max {
+			max = wire.Rank
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "digraph circuit {\n")
+	fmt.Fprintf(w, "\trankdir=LR;\n")
+	fmt.Fprintf(w, "\tnode [style=filled];\n")
+	for _, wire := range wires {
+		hue := 0.0
+		if max > min {
+			hue = (wire.Rank - min) / (max - min)
+		}
+		label := wire.Name
+		if list := aliases[wire.Name]; len(list) > 0 {
+			label += "\\n" + strings.Join(list, " ")
+		}
+		shape := "ellipse"
+		if isGarbage(aliases[wire.Name]) {
+			shape = "octagon"
+		}
+		fmt.Fprintf(w, "\tw%d [label=\"%s\", shape=%s, fillcolor=\"%.3f 0.600 1.000\"];\n",
+			wire.Index, label, shape, 0.667*(1-hue))
+	}
+	for i := range c.Gates {
+		gate := &c.Gates[i]
+		fmt.Fprintf(w, "\tg%d [label=\"%s\", shape=box, fillcolor=white];\n", i, gate.Type)
+		for j, control := range gate.Controls() {
+			style := "solid"
+			if gate.negative(j) {
+				style = "dashed"
+			}
+			fmt.Fprintf(w, "\tw%d -> g%d [style=%s];\n", control, i, style)
+		}
+		for _, target := range gate.Targets() {
+			fmt.Fprintf(w, "\tg%d -> w%d;\n", i, target)
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+	return w.Flush()
+}
+
+// WriteSVG draws the circuit as horizontal wires with one column per gate,
+// input aliases are on the left, output aliases on the right and garbage
+// wires are gray
+func (c *Circuit) WriteSVG(out io.Writer) error {
+	const (
+		row, column, radius = 24, 24, 7
+	)
+	wires, aliases := c.WiresByIndex(), c.aliasesByWire()
+	left, right := make([]string, len(wires)), make([]string, len(wires))
+	labels := 0
+	for i, wire := range wires {
+		var inputs, outputs []string
+		for _, alias := range aliases[wire.Name] {
+			if prefix, _, ok := splitName(alias); ok && prefix == "I" {
+				inputs = append(inputs, alias)
+			} else {
+				outputs = append(outputs, alias)
+			}
+		}
+		left[i] = wire.Name
+		if len(inputs) > 0 {
+			left[i] += " (" + strings.Join(inputs, " ") + ")"
+		}
+		right[i] = strings.Join(outputs, " ")
+		if n := len(left[i]); n > labels {
+			labels = n
+		}
+		if n := len(right[i]); n > labels {
+			labels = n
+		}
+	}
+	margin := 8*labels + 16
+	width, height := 2*margin+column*(len(c.Gates)+1), row*(len(wires)+1)
+	y := func(tap uint32) int {
+		return row * (int(tap) + 1)
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n", width, height)
+	fmt.Fprintf(w, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	for i, wire := range wires {
+		color := "black"
+		if isGarbage(aliases[wire.Name]) {
+			color = "gray"
+		}
+		fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\"/>\n",
+			margin, y(wire.Index), width-margin, y(wire.Index), color)
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" text-anchor=\"end\">%s</text>\n",
+			margin-4, y(wire.Index)+4, html.EscapeString(left[i]))
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" fill=\"%s\">%s</text>\n",
+			width-margin+4, y(wire.Index)+4, color, html.EscapeString(right[i]))
+	}
+	for i := range c.Gates {
+		gate, x := &c.Gates[i], margin+column*(i+1)
+		low, high := gate.Taps[0], gate.Taps[0]
+		for _, tap := range gate.Taps {
+			if tap < low {
+				low = tap
+			}
+			if tap > high {
+				high = tap
+			}
+		}
+		fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>\n", x, y(low), x, y(high))
+		for j, control := range gate.Controls() {
+			fill := "black"
+			if gate.negative(j) {
+				fill = "white"
+			}
+			fmt.Fprintf(w, "<circle cx=\"%d\" cy=\"%d\" r=\"%d\" fill=\"%s\" stroke=\"black\"/>\n", x, y(control), radius/2+1, fill)
+		}
+		for _, target := range gate.Targets() {
+			if gate.Type == GateTypeFredkin {
+				fmt.Fprintf(w, "<path d=\"M%d %dl%d %dm0 %dl%d %d\" stroke=\"black\"/>\n",
+					x-radius/2-1, y(target)-radius/2-1, radius+1, radius+1, -radius-1, -radius-1, radius+1)
+				continue
+			}
+			fmt.Fprintf(w, "<circle cx=\"%d\" cy=\"%d\" r=\"%d\" fill=\"white\" stroke=\"black\"/>\n", x, y(target), radius)
+			fmt.Fprintf(w, "<path d=\"M%d %dh%dM%d %dv%d\" stroke=\"black\"/>\n",
+				x-radius, y(target), 2*radius, x, y(target)-radius, 2*radius)
+		}
+		if gate.Type == GateTypePeres {
+			fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">P</text>\n", x, y(low)-radius-2)
+		}
+	}
+	fmt.Fprintf(w, "</svg>\n")
+	return w.Flush()
+}
@@ -0,0 +1,305 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The RevLib .real format has no notion of buses or aliases, so they are
+// stored in "# janus" comments which other tools ignore.
+const realDirective = "# janus"
+
+func splitName(name string) (prefix string, index int, ok bool) {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	if i == len(name) {
+		return name, 0, false
+	}
+	index, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return name, 0, false
+	}
+	return name[:i], index, true
+}
+
+func (c *Circuit) WiresByIndex() []Wire {
+	wires := make([]Wire, len(c.Wires))
+	for _, wire := range c.Wires {
+		wires[wire.Index] = wire
+	}
+	return wires
+}
+
+func (c *Circuit) WriteReal(out io.Writer) error {
+	wires := c.WiresByIndex()
+	aliases := make(map[string][]string)
+	for alias, name := range c.Aliases {
+		aliases[name] = append(aliases[name], alias)
+	}
+	inBus := func(name, bus string) bool {
+		for _, alias := range aliases[name] {
+			if prefix, _, ok := splitName(alias); ok && prefix == bus {
+				return true
+			}
+		}
+		return false
+	}
+
+	variables, outputs := make([]string, len(wires)), make([]string, len(wires))
+	constants, garbage := make([]byte, len(wires)), make([]byte, len(wires))
+	for i, wire := range wires {
+		variables[i], outputs[i] = wire.Name, wire.Name
+		sort.Strings(aliases[wire.Name])
+		for _, alias := range aliases[wire.Name] {
+			if prefix, _, ok := splitName(alias); ok && prefix != "I" && prefix != "G" {
+				outputs[i] = alias
+				break
+			}
+		}
+		switch {
+		case inBus(wire.Name, "I"):
+			constants[i] = '-'
+		case wire.Nominal:
+			constants[i] = '1'
+		default:
+			constants[i] = '0'
+		}
+		if inBus(wire.Name, "G") {
+			garbage[i] = '1'
+		} else {
+			garbage[i] = '-'
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, ".version 2.0\n")
+	fmt.Fprintf(w, ".numvars %d\n", len(wires))
+	fmt.Fprintf(w, ".variables %s\n", strings.Join(variables, " "))
+	fmt.Fprintf(w, ".inputs %s\n", strings.Join(variables, " "))
+	fmt.Fprintf(w, ".outputs %s\n", strings.Join(outputs, " "))
+	fmt.Fprintf(w, ".constants %s\n", constants)
+	fmt.Fprintf(w, ".garbage %s\n", garbage)
+
+	buses := make([]string, 0, len(c.Buses))
+	for prefix := range c.Buses {
+		buses = append(buses, prefix)
+	}
+	sort.Strings(buses)
+	for _, prefix := range buses {
+		fmt.Fprintf(w, "%s bus %s %d\n", realDirective, prefix, c.Buses[prefix])
+	}
+	names := make([]string, 0, len(c.Aliases))
+	for alias := range c.Aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	for _, alias := range names {
+		fmt.Fprintf(w, "%s alias %s %s\n", realDirective, alias, c.Aliases[alias])
+	}
+
+	fmt.Fprintf(w, ".begin\n")
+	for _, gate := range c.Gates {
+		kind, count := "t", 0
+		switch gate.Type {
+		case GateTypeNot:
+			count = 1
+		case GateTypeCNot:
+			count = 2
+		case GateTypeCCNot:
+			count = 3
+		case GateTypeFredkin:
+			kind, count = "f", 3
+		case GateTypePeres:
+			kind, count = "p", 3
+		case GateTypeMCNot:
+			count = len(gate.Taps)
+		default:
+			return fmt.Errorf("gate type %d not supported by .real", gate.Type)
+		}
+		fmt.Fprintf(w, "%s%d", kind, count)
+		for i, tap := range gate.Taps[:count] {
+			if gate.Negative != nil && i < len(gate.Negative) && gate.Negative[i] {
+				fmt.Fprintf(w, " -%s", wires[tap].Name)
+			} else {
+				fmt.Fprintf(w, " %s", wires[tap].Name)
+			}
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, ".end\n")
+	return w.Flush()
+}
+
+func ReadReal(in io.Reader) (Circuit, error) {
+	circuit := NewCircuit()
+	var variables, outputs []string
+	var constants, garbage string
+	buses, begin, end := false, false, false
+
+	scanner, line := bufio.NewScanner(in), 0
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, realDirective+" ") {
+			fields := strings.Fields(strings.TrimPrefix(text, realDirective))
+			switch {
+			case len(fields) == 3 && fields[0] == "bus":
+				count, err := strconv.ParseUint(fields[2], 10, 32)
+				if err != nil {
+					return circuit, fmt.Errorf("line %d: invalid bus width %s", line, fields[2])
+				}
+				circuit.Buses[fields[1]] = uint32(count)
+				buses = true
+			case len(fields) == 3 && fields[0] == "alias":
+				circuit.Aliases[fields[1]] = fields[2]
+			default:
+				return circuit, fmt.Errorf("line %d: invalid directive %s", line, text)
+			}
+			continue
+		}
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if end {
+			return circuit, fmt.Errorf("line %d: content after .end", line)
+		}
+
+		if !begin {
+			switch strings.ToLower(fields[0]) {
+			case ".version", ".numvars", ".inputs", ".define", ".enddefine":
+			case ".variables":
+				variables = fields[1:]
+				for i, name := range variables {
+					if _, ok := circuit.Wires[name]; ok {
+						return circuit, fmt.Errorf("line %d: variable %s already exists", line, name)
+					}
+					circuit.Wires[name] = Wire{
+						Name:  name,
+						Index: uint32(i),
+					}
+				}
+			case ".outputs":
+				outputs = fields[1:]
+			case ".constants":
+				constants = strings.Join(fields[1:], "")
+			case ".garbage":
+				garbage = strings.Join(fields[1:], "")
+			case ".begin":
+				begin = true
+			default:
+				return circuit, fmt.Errorf("line %d: unknown header %s", line, fields[0])
+			}
+			continue
+		}
+
+		if strings.ToLower(fields[0]) == ".end" {
+			end = true
+			continue
+		}
+		kind := strings.ToLower(fields[0])
+		if len(kind) < 2 {
+			return circuit, fmt.Errorf("line %d: gate %s not supported", line, fields[0])
+		}
+		count, err := strconv.Atoi(kind[1:])
+		if err != nil || count < 1 || count != len(fields)-1 {
+			return circuit, fmt.Errorf("line %d: invalid gate %s", line, text)
+		}
+		gate := Gate{
+			Taps: make([]uint32, count),
+		}
+		negative := make([]bool, count-1)
+		for i, name := range fields[1:] {
+			if i < len(negative) && kind[0] == 't' && strings.HasPrefix(name, "-") {
+				name, negative[i], gate.Negative = name[1:], true, negative
+			}
+			wire, ok := circuit.Wires[name]
+			if !ok {
+				return circuit, fmt.Errorf("line %d: unknown variable %s", line, name)
+			}
+			gate.Taps[i] = wire.Index
+		}
+		switch {
+		case kind[0] == 't' && (count > 3 || gate.Negative != nil):
+			gate.Type = GateTypeMCNot
+		case kind == "t1":
+			gate.Type = GateTypeNot
+		case kind == "t2":
+			gate.Type = GateTypeCNot
+		case kind == "t3":
+			gate.Type = GateTypeCCNot
+		case kind == "f3":
+			gate.Type = GateTypeFredkin
+		case kind == "p3":
+			gate.Type = GateTypePeres
+		default:
+			return circuit, fmt.Errorf("line %d: gate %s not supported", line, fields[0])
+		}
+		circuit.Gates = append(circuit.Gates, gate)
+	}
+	if err := scanner.Err(); err != nil {
+		return circuit, err
+	}
+	if !begin || !end {
+		return circuit, fmt.Errorf("missing .begin or .end")
+	}
+	if constants != "" && len(constants) != len(variables) {
+		return circuit, fmt.Errorf(".constants has %d entries, expected %d", len(constants), len(variables))
+	}
+	if garbage != "" && len(garbage) != len(variables) {
+		return circuit, fmt.Errorf(".garbage has %d entries, expected %d", len(garbage), len(variables))
+	}
+	if outputs != nil && len(outputs) != len(variables) {
+		return circuit, fmt.Errorf(".outputs has %d entries, expected %d", len(outputs), len(variables))
+	}
+
+	for i, name := range variables {
+		if i < len(constants) && constants[i] == '1' {
+			wire := circuit.Wires[name]
+			wire.Nominal = true
+			circuit.Wires[name] = wire
+		}
+	}
+	for alias, name := range circuit.Aliases {
+		if _, ok := circuit.Wires[name]; !ok {
+			return circuit, fmt.Errorf("alias %s refers to unknown wire %s", alias, name)
+		}
+	}
+	if buses {
+		return circuit, circuit.Validate()
+	}
+
+	// Without janus directives the inputs, outputs and garbage are exposed
+	// as the buses I, O and G.
+	circuit.Buses["I"], circuit.Buses["O"], circuit.Buses["G"] = 0, 0, 0
+	alias := func(name, bus string) {
+		i := circuit.Buses[bus]
+		circuit.Buses[bus] = i + 1
+		circuit.Aliases[fmt.Sprintf("%s%d", bus, i)] = name
+	}
+	for i, name := range variables {
+		if constants == "" || constants[i] == '-' {
+			alias(name, "I")
+		}
+		if garbage != "" && garbage[i] != '-' {
+			alias(name, "G")
+		} else {
+			alias(name, "O")
+		}
+	}
+	return circuit, circuit.Validate()
+}
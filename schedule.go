@@ -0,0 +1,90 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Schedule groups the gates of a circuit into layers of gates which don't
+// write to a wire used by another gate of the same layer
+type Schedule struct {
+	Layers    [][]Gate
+	Workers   int
+	Threshold int
+}
+
+func (c *Circuit) NewSchedule() *Schedule {
+	reads, writes := make([]int, len(c.Wires)), make([]int, len(c.Wires))
+	var layers [][]Gate
+	for i := range c.Gates {
+		gate := &c.Gates[i]
+		level := 0
+		for _, tap := range gate.Taps {
+			if writes[tap] > level {
+				level = writes[tap]
+			}
+		}
+		for _, target := range gate.Targets() {
+			if reads[target] > level {
+				level = reads[target]
+			}
+		}
+		for _, tap := range gate.Taps {
+			if level+1 > reads[tap] {
+				reads[tap] = level + 1
+			}
+		}
+		for _, target := range gate.Targets() {
+			writes[target] = level + 1
+		}
+		if level == len(layers) {
+			layers = append(layers, nil)
+		}
+		layers[level] = append(layers[level], *gate)
+	}
+	return &Schedule{
+		Layers:    layers,
+		Workers:   runtime.NumCPU(),
+		Threshold: 64,
+	}
+}
+
+// Run calls apply for every gate, layers with at least Threshold gates are
+// split across Workers goroutines
+func (s *Schedule) Run(reverse bool, apply func(worker int, gate *Gate)) {
+	var wait sync.WaitGroup
+	for i := range s.Layers {
+		layer := s.Layers[i]
+		if reverse {
+			layer = s.Layers[len(s.Layers)-1-i]
+		}
+		if s.Workers < 2 || len(layer) < s.Threshold {
+			for j := range layer {
+				apply(0, &layer[j])
+			}
+			continue
+		}
+		size := (len(layer) + s.Workers - 1) / s.Workers
+		for worker := 0; worker < s.Workers; worker++ {
+			start, end := worker*size, (worker+1)*size
+			if start >= len(layer) {
+				break
+			}
+			if end > len(layer) {
+				end = len(layer)
+			}
+			wait.Add(1)
+			go func(worker int, gates []Gate) {
+				defer wait.Done()
+				for j := range gates {
+					apply(worker, &gates[j])
+				}
+			}(worker, layer[start:end])
+		}
+		wait.Wait()
+	}
+}
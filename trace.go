@@ -0,0 +1,528 @@
+// Copyright 2018 The Janus Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const traceMagic = "janus trace 1\n"
+
+// Tracer is called by Execute with the values of the taps before and after
+// each gate, the slices are reused between calls
+type Tracer[T any] func(index int, gate *Gate, reverse bool, before, after []T)
+
+// traceGates applies the gates in order and calls tracer for each one
+func traceGates[T any](gates []Gate, memory []T, reverse bool, apply func(gate *Gate, reverse bool), tracer Tracer[T]) {
+	var before, after []T
+	step := func(i int) {
+		gate := &gates[i]
+		before, after = before[:0], after[:0]
+		for _, tap := range gate.Taps {
+			before = append(before, memory[tap])
+		}
+		apply(gate, reverse)
+		for _, tap := range gate.Taps {
+			after = append(after, memory[tap])
+		}
+		tracer(i, gate, reverse, before, after)
+	}
+
+	if reverse {
+		for i := len(gates) - 1; i >= 0; i-- {
+			step(i)
+		}
+		return
+	}
+
+	for i := range gates {
+		step(i)
+	}
+}
+
+type TraceKind uint8
+
+const (
+	TraceKindBool TraceKind = iota
+	TraceKindParallel
+	TraceKindFloat
+	TraceKindDual
+)
+
+// Cell is the value of a tap, Lanes is used by parallel devices and Der by
+// dual devices
+type Cell struct {
+	Val, Der float64
+	Lanes    uint64
+}
+
+// Step is the application of one gate
+type Step struct {
+	Gate          uint32
+	Reverse       bool
+	Before, After []Cell
+}
+
+// Trace is a record of the taps of each gate applied by a device
+type Trace struct {
+	Kind  TraceKind
+	Names []string
+	Buses map[string][]uint32
+	Gates []Gate
+	Steps []Step
+	// Latest keeps only the steps of the most recent Execute
+	Latest bool
+}
+
+// NewTrace creates an empty trace for circuit
+func NewTrace(c *Circuit) *Trace {
+	wires := c.WiresByIndex()
+	names := make([]string, len(wires))
+	for i, wire := range wires {
+		names[i] = wire.Name
+	}
+	buses := make(map[string][]uint32, len(c.Buses))
+	for prefix := range c.Buses {
+		buses[prefix] = NewBus(c, prefix)
+	}
+	return &Trace{
+		Names: names,
+		Buses: buses,
+		Gates: append([]Gate{}, c.Gates...),
+	}
+}
+
+func record[T any](t *Trace, kind TraceKind, cell func(value T) Cell) Tracer[T] {
+	t.Kind = kind
+	return func(index int, gate *Gate, reverse bool, before, after []T) {
+		if t.Latest && ((!reverse && index == 0) || (reverse && index == len(t.Gates)-1)) {
+			t.Steps = t.Steps[:0]
+		}
+		step := Step{
+			Gate:    uint32(index),
+			Reverse: reverse,
+			Before:  make([]Cell, len(before)),
+			After:   make([]Cell, len(after)),
+		}
+		for i := range before {
+			step.Before[i], step.After[i] = cell(before[i]), cell(after[i])
+		}
+		t.Steps = append(t.Steps, step)
+	}
+}
+
+// TraceBool records the execution of a DeviceBool
+func TraceBool(t *Trace) Tracer[bool] {
+	return record(t, TraceKindBool, func(value bool) Cell {
+		if value {
+			return Cell{Val: 1}
+		}
+		return Cell{}
+	})
+}
+
+// TraceParallel records the execution of a DeviceParallel
+func TraceParallel(t *Trace) Tracer[uint64] {
+	return record(t, TraceKindParallel, func(value uint64) Cell {
+		return Cell{Lanes: value}
+	})
+}
+
+// TraceFloat records the execution of a float device
+func TraceFloat[F Float](t *Trace) Tracer[F] {
+	return record(t, TraceKindFloat, func(value F) Cell {
+		return Cell{Val: float64(value)}
+	})
+}
+
+// TraceDual records the execution of a dual device
+func TraceDual[F Float](t *Trace) Tracer[DualOf[F]] {
+	return record(t, TraceKindDual, func(value DualOf[F]) Cell {
+		return Cell{Val: float64(value.Val), Der: float64(value.Der)}
+	})
+}
+
+type traceWriter struct {
+	*bufio.Writer
+	buffer [binary.MaxVarintLen64]byte
+}
+
+func (w *traceWriter) uvarint(value uint64) {
+	n := binary.PutUvarint(w.buffer[:], value)
+	w.Write(w.buffer[:n])
+}
+
+func (w *traceWriter) string(value string) {
+	w.uvarint(uint64(len(value)))
+	w.WriteString(value)
+}
+
+func (w *traceWriter) uint64(value uint64) {
+	binary.LittleEndian.PutUint64(w.buffer[:8], value)
+	w.Write(w.buffer[:8])
+}
+
+func (w *traceWriter) cell(kind TraceKind, cell Cell) {
+	switch kind {
+	case TraceKindBool:
+		w.WriteByte(byte(cell.Val))
+	case TraceKindParallel:
+		w.uint64(cell.Lanes)
+	case TraceKindFloat:
+		w.uint64(math.Float64bits(cell.Val))
+	case TraceKindDual:
+		w.uint64(math.Float64bits(cell.Val))
+		w.uint64(math.Float64bits(cell.Der))
+	}
+}
+
+// Write writes the trace in a compressed binary format
+func (t *Trace) Write(out io.Writer) error {
+	compressed := gzip.NewWriter(out)
+	w := traceWriter{Writer: bufio.NewWriter(compressed)}
+	w.WriteString(traceMagic)
+	w.WriteByte(byte(t.Kind))
+
+	w.uvarint(uint64(len(t.Names)))
+	for _, name := range t.Names {
+		w.string(name)
+	}
+
+	prefixes := make([]string, 0, len(t.Buses))
+	for prefix := range t.Buses {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	w.uvarint(uint64(len(prefixes)))
+	for _, prefix := range prefixes {
+		w.string(prefix)
+		w.uvarint(uint64(len(t.Buses[prefix])))
+		for _, index := range t.Buses[prefix] {
+			w.uvarint(uint64(index))
+		}
+	}
+
+	w.uvarint(uint64(len(t.Gates)))
+	for _, gate := range t.Gates {
+		w.WriteByte(byte(gate.Type))
+		w.uvarint(uint64(len(gate.Taps)))
+		for _, tap := range gate.Taps {
+			w.uvarint(uint64(tap))
+		}
+		w.uvarint(uint64(len(gate.Negative)))
+		for _, negative := range gate.Negative {
+			if negative {
+				w.WriteByte(1)
+			} else {
+				w.WriteByte(0)
+			}
+		}
+	}
+
+	w.uvarint(uint64(len(t.Steps)))
+	for _, step := range t.Steps {
+		w.uvarint(uint64(step.Gate))
+		if step.Reverse {
+			w.WriteByte(1)
+		} else {
+			w.WriteByte(0)
+		}
+		for _, cell := range step.Before {
+			w.cell(t.Kind, cell)
+		}
+		for _, cell := range step.After {
+			w.cell(t.Kind, cell)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+type traceReader struct {
+	*bufio.Reader
+	err error
+}
+
+func (r *traceReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var value uint64
+	value, r.err = binary.ReadUvarint(r)
+	return value
+}
+
+// count reads a length that can't be larger than limit
+func (r *traceReader) count(limit int) int {
+	value := r.uvarint()
+	if r.err == nil && value > uint64(limit) {
+		r.err = fmt.Errorf("length %d is larger than %d", value, limit)
+		return 0
+	}
+	return int(value)
+}
+
+func (r *traceReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	var value byte
+	value, r.err = r.ReadByte()
+	return value
+}
+
+func (r *traceReader) string() string {
+	length := r.count(1 << 16)
+	if r.err != nil {
+		return ""
+	}
+	value := make([]byte, length)
+	_, r.err = io.ReadFull(r, value)
+	return string(value)
+}
+
+func (r *traceReader) uint64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var buffer [8]byte
+	_, r.err = io.ReadFull(r, buffer[:])
+	return binary.LittleEndian.Uint64(buffer[:])
+}
+
+func (r *traceReader) cell(kind TraceKind) Cell {
+	switch kind {
+	case TraceKindBool:
+		return Cell{Val: float64(r.byte())}
+	case TraceKindParallel:
+		return Cell{Lanes: r.uint64()}
+	case TraceKindFloat:
+		return Cell{Val: math.Float64frombits(r.uint64())}
+	}
+	return Cell{Val: math.Float64frombits(r.uint64()), Der: math.Float64frombits(r.uint64())}
+}
+
+// ReadTrace reads a trace written by Write
+func ReadTrace(in io.Reader) (*Trace, error) {
+	compressed, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+	r := traceReader{Reader: bufio.NewReader(compressed)}
+	magic := make([]byte, len(traceMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != traceMagic {
+		return nil, errors.New("not a trace file")
+	}
+	t := &Trace{
+		Kind:  TraceKind(r.byte()),
+		Buses: make(map[string][]uint32),
+	}
+	if t.Kind > TraceKindDual {
+		return nil, fmt.Errorf("unknown trace kind %d", t.Kind)
+	}
+
+	// the slices grow as their records are decoded, so a corrupt count
+	// fails on the first missing record instead of allocating it up front
+	names := r.count(1 << 30)
+	for i := 0; i < names && r.err == nil; i++ {
+		t.Names = append(t.Names, r.string())
+	}
+	wire := func() uint32 {
+		index := r.uvarint()
+		if r.err == nil && index >= uint64(len(t.Names)) {
+			r.err = fmt.Errorf("wire %d not found", index)
+		}
+		return uint32(index)
+	}
+
+	buses := r.count(len(t.Names))
+	for i := 0; i < buses && r.err == nil; i++ {
+		prefix := r.string()
+		var bus []uint32
+		wires := r.count(len(t.Names))
+		for j := 0; j < wires && r.err == nil; j++ {
+			bus = append(bus, wire())
+		}
+		t.Buses[prefix] = bus
+	}
+
+	gates := r.count(1 << 30)
+	for i := 0; i < gates && r.err == nil; i++ {
+		gate := Gate{Type: GateType(r.byte())}
+		taps := r.count(len(t.Names))
+		for j := 0; j < taps && r.err == nil; j++ {
+			gate.Taps = append(gate.Taps, wire())
+		}
+		if count := r.count(len(gate.Taps)); count > 0 {
+			gate.Negative = make([]bool, count)
+			for j := range gate.Negative {
+				gate.Negative[j] = r.byte() == 1
+			}
+		}
+		t.Gates = append(t.Gates, gate)
+	}
+
+	steps := r.count(1 << 30)
+	for i := 0; i < steps && r.err == nil; i++ {
+		index := r.uvarint()
+		if r.err != nil {
+			break
+		} else if index >= uint64(len(t.Gates)) {
+			return nil, fmt.Errorf("step %d: gate %d not found", i, index)
+		}
+		step := Step{Gate: uint32(index), Reverse: r.byte() == 1}
+		taps := len(t.Gates[index].Taps)
+		step.Before, step.After = make([]Cell, taps), make([]Cell, taps)
+		for j := range step.Before {
+			step.Before[j] = r.cell(t.Kind)
+		}
+		for j := range step.After {
+			step.After[j] = r.cell(t.Kind)
+		}
+		t.Steps = append(t.Steps, step)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return t, nil
+}
+
+// Select returns the wires of the named buses and wires
+func (t *Trace) Select(names ...string) (map[uint32]bool, error) {
+	selected := make(map[uint32]bool)
+	wires := make(map[string]uint32, len(t.Names))
+	for i, name := range t.Names {
+		wires[name] = uint32(i)
+	}
+	for _, name := range names {
+		if bus, ok := t.Buses[name]; ok {
+			for _, index := range bus {
+				selected[index] = true
+			}
+		} else if index, ok := wires[name]; ok {
+			selected[index] = true
+		} else if prefix, i, ok := splitName(name); ok && i < len(t.Buses[prefix]) {
+			selected[t.Buses[prefix][i]] = true
+		} else {
+			return nil, fmt.Errorf("wire or bus %s not found", name)
+		}
+	}
+	return selected, nil
+}
+
+func (t *Trace) format(cell Cell) string {
+	switch t.Kind {
+	case TraceKindBool:
+		return strconv.Itoa(int(cell.Val))
+	case TraceKindParallel:
+		return fmt.Sprintf("%016x", cell.Lanes)
+	case TraceKindFloat:
+		return fmt.Sprintf("%g", cell.Val)
+	}
+	return fmt.Sprintf("%g (%g)", cell.Val, cell.Der)
+}
+
+// PrintStep prints the taps of step i, selected taps are marked with a *
+func (t *Trace) PrintStep(out io.Writer, i int, selected map[uint32]bool) {
+	step := t.Steps[i]
+	gate := t.Gates[step.Gate]
+	direction := "forward"
+	if step.Reverse {
+		direction = "reverse"
+	}
+	fmt.Fprintf(out, "step %d/%d gate %d %s %s\n", i, len(t.Steps), step.Gate, gate.Type, direction)
+	for j, tap := range gate.Taps {
+		mark, name := " ", t.Names[tap]
+		if selected[tap] {
+			mark = "*"
+		}
+		if j < len(gate.Negative) && gate.Negative[j] {
+			name = "-" + name
+		}
+		fmt.Fprintf(out, "%s %s %s -> %s\n", mark, name, t.format(step.Before[j]), t.format(step.After[j]))
+	}
+}
+
+// Replay steps through the trace with the commands read from in: n or an empty
+// line moves to the next step and p to the previous step that touches a
+// selected wire, g moves to the given step and q quits
+func (t *Trace) Replay(in io.Reader, out io.Writer, selected map[uint32]bool) error {
+	matches := func(i int) bool {
+		if len(selected) == 0 {
+			return true
+		}
+		for _, tap := range t.Gates[t.Steps[i].Gate].Taps {
+			if selected[tap] {
+				return true
+			}
+		}
+		return false
+	}
+	seek := func(i, direction int) int {
+		for ; i >= 0 && i < len(t.Steps); i += direction {
+			if matches(i) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	current := seek(0, 1)
+	if current < 0 {
+		return errors.New("no step touches the selected wires")
+	}
+	t.PrintStep(out, current, selected)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		command := "n"
+		if len(fields) > 0 {
+			command = fields[0]
+		}
+		next := current
+		switch command {
+		case "n":
+			next = seek(current+1, 1)
+		case "p":
+			next = seek(current-1, -1)
+		case "g":
+			if len(fields) != 2 {
+				fmt.Fprintln(out, "usage: g step")
+				continue
+			}
+			step, err := strconv.Atoi(fields[1])
+			if err != nil || step < 0 || step >= len(t.Steps) {
+				fmt.Fprintf(out, "step must be [0,%d)\n", len(t.Steps))
+				continue
+			}
+			next = step
+		case "q":
+			return nil
+		default:
+			fmt.Fprintln(out, "commands: n, p, g step, q")
+			continue
+		}
+		if next < 0 {
+			fmt.Fprintln(out, "no more steps")
+			continue
+		}
+		current = next
+		t.PrintStep(out, current, selected)
+	}
+	return scanner.Err()
+}